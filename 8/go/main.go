@@ -1,206 +1,576 @@
 package main
 
 import (
-	"image"
+	"context"
+	"flag"
+	"fmt"
 	"image/color"
-	"image/png"
 	"log"
 	"math"
-	"math/rand"
 	"os"
 	"path/filepath"
+	"runtime/pprof"
+	"slices"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"gocg8/tracer"
+
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/vector"
 	"github.com/sqweek/dialog"
 )
 
 const (
-	screenWidth     = 1600
-	screenHeight    = 600
-	shadowBias      = 0.0001 // Смещение для избежания самозатенения
-	maxReflections  = 4      // Максимальное количество отражений
-	samplesPerPixel = 3      // Сэмплов на пиксель (для антиалиасинга)
-	gorutineLines   = 90     // Количество строк на одну горутину
+	screenWidth  = 1600
+	screenHeight = 600
+
+	unboundedSamples = 64 // Сетка страт прогрессивного рендера без ограничения проходов
 )
 
-var (
-	objects        []SceneObject              // Объекты сцены
-	light          DirectionalLight           // Источник света
-	camera         Camera                     // Камера
-	img            *image.RGBA                // Изображение для рендеринга
-	saveKeyPressed bool                       // Флаг нажатия клавиши сохранения
-	skybox, _      = NewSkybox("skubox.jpeg") // Скайбокс
+// Управление камерой в окне
+const (
+	previewScale      = 4                      // Во сколько раз предпросмотр меньше окна
+	settleDelay       = 250 * time.Millisecond // Пауза после движения, после которой начинается полный рендер
+	flySpeed          = 5.0                    // Скорость полёта в единицах сцены в секунду, с Shift - вчетверо больше
+	orbitSensitivity  = 0.3                    // Градусов поворота на пиксель перетаскивания
+	dragThreshold     = 3                      // Сдвиг курсора в пикселях, после которого нажатие считается перетаскиванием
+	zoomStep          = 0.9                    // Изменение расстояния до точки фокуса за деление колеса
+	fovStep           = 5.0                    // Изменение угла обзора за нажатие, в градусах
+	minFOV, maxFOV    = 10.0, 120.0            // Пределы угла обзора
+	scenePollInterval = 500 * time.Millisecond // Период проверки файла сцены на изменения
 )
 
-func initScene() {
+// Клавиши отладочных режимов, по порядку tracer.DebugModes
+var debugKeys = []ebiten.Key{ebiten.Key0, ebiten.Key1, ebiten.Key2, ebiten.Key3, ebiten.Key4, ebiten.Key5, ebiten.Key6, ebiten.Key7}
+
+// Построение сцены
+func initScene() *tracer.Scene {
 	// Инициализация камеры
-	camera = NewCamera(
-		Vector{0, 0, 10}, // Позиция камеры
-		Vector{float64(screenWidth), float64(screenHeight), 0}, // Разрешение
+	camera := tracer.NewCamera(
+		tracer.NewVector(0, 0, 10),                                       // Позиция камеры
+		tracer.NewVector(float64(screenWidth), float64(screenHeight), 0), // Разрешение
 		60,   // Угол обзора
 		15.0, // Фокусное расстояние
 		0.5,  // Апертура
 	)
 
 	// Материал для куба
-	cubeMaterial := Material{
-		DiffuseColor:  Vector{0.8, 0.5, 0.2}, // Диффузный цвет
-		SpecularColor: Vector{0.5, 0.5, 0.5}, // Зеркальный цвет
-		AmbientColor:  Vector{0.1, 0.1, 0.1}, // Фоновый цвет
-		Shininess:     20,                    // Блеск
-		Reflectivity:  0.3,                   // Отражательная способность
+	cubeMaterial := tracer.Material{
+		DiffuseColor:  tracer.NewVector(0.8, 0.5, 0.2), // Диффузный цвет
+		SpecularColor: tracer.NewVector(0.5, 0.5, 0.5), // Зеркальный цвет
+		AmbientColor:  tracer.NewVector(0.1, 0.1, 0.1), // Фоновый цвет
+		Shininess:     20,                              // Блеск
+		Reflectivity:  0.3,                             // Отражательная способность
 	}
-	cube := NewCube(Vector{-7, -2, -10}, 2.0, cubeMaterial)
+	cube := tracer.NewCube(tracer.NewVector(-7, -2, -10), 2.0, cubeMaterial)
 
 	// Материал для тора
-	torus := NewTorus(1.0, 0.3, Material{
-		DiffuseColor:  Vector{0.7, 1, 1},
-		SpecularColor: Vector{0.5, 0.5, 0.5},
-		AmbientColor:  Vector{0.1, 0.1, 0.1},
+	torus := tracer.NewTorus(1.0, 0.3, tracer.Material{
+		DiffuseColor:  tracer.NewVector(0.7, 1, 1),
+		SpecularColor: tracer.NewVector(0.5, 0.5, 0.5),
+		AmbientColor:  tracer.NewVector(0.1, 0.1, 0.1),
 		Shininess:     20,
 		Reflectivity:  0.3,
 	})
 
 	// Материал для тетраэдра
-	tetrahedronMaterial := Material{
-		DiffuseColor:  Vector{0.1, 0.1, 0.9}, // Синий цвет
-		SpecularColor: Vector{0.5, 0.5, 0.5},
-		AmbientColor:  Vector{0.1, 0.1, 0.1},
+	tetrahedronMaterial := tracer.Material{
+		DiffuseColor:  tracer.NewVector(0.1, 0.1, 0.9), // Синий цвет
+		SpecularColor: tracer.NewVector(0.5, 0.5, 0.5),
+		AmbientColor:  tracer.NewVector(0.1, 0.1, 0.1),
 		Shininess:     20,
 		Reflectivity:  0.3,
 	}
 
 	// Создание тетраэдра с базовыми вершинами
-	tetrahedron := NewTetrahedron(
-		Vector{3, -2, -10},
-		Vector{5, -2, -10},
-		Vector{4, 0, -10},
-		Vector{4, -2, -8},
+	tetrahedron := tracer.NewTetrahedron(
+		tracer.NewVector(3, -2, -10),
+		tracer.NewVector(5, -2, -10),
+		tracer.NewVector(4, 0, -10),
+		tracer.NewVector(4, -2, -8),
 		tetrahedronMaterial,
 	)
 
 	// Применение преобразований к тетраэдру
-	transform := Identity().
-		Multiply(Translate(-5, -1, 5)). // Перемещение
-		Multiply(RotateY(math.Pi / 4)). // Вращение вокруг Y
-		Multiply(Scale(1.5, 1.5, 1.5))  // Масштабирование
+	transform := tracer.Identity().
+		Multiply(tracer.Translate(-5, -1, 5)). // Перемещение
+		Multiply(tracer.RotateY(math.Pi / 4)). // Вращение вокруг Y
+		Multiply(tracer.Scale(1.5, 1.5, 1.5))  // Масштабирование
 
 	tetrahedron.ApplyTransform(transform)
 
 	// Добавление объектов на сцену
-	objects = []SceneObject{
+	objects := []tracer.SceneObject{
 		torus,
 		cube,
 		tetrahedron,
-		NewInfinityChessBoard( // Бесконечная шахматная доска
+		tracer.NewInfinityChessBoard( // Бесконечная шахматная доска
 			2,
-			Vector{0, 0, 0},
-			Vector{1, 1, 1},
+			tracer.NewVector(0, 0, 0),
+			tracer.NewVector(1, 1, 1),
 		),
-		NewSphere( // Сфера
-			Vector{0, -2, -15}, 2,
-			Material{
-				DiffuseColor:  Vector{1, 1, 0}, // Желтый цвет
-				SpecularColor: Vector{1, 1, 1},
-				AmbientColor:  Vector{0.1, 0.1, 0.1},
+		tracer.NewSphere( // Сфера
+			tracer.NewVector(0, -2, -15), 2,
+			tracer.Material{
+				DiffuseColor:  tracer.NewVector(1, 1, 0), // Желтый цвет
+				SpecularColor: tracer.NewVector(1, 1, 1),
+				AmbientColor:  tracer.NewVector(0.1, 0.1, 0.1),
 				Shininess:     32,
 			},
 		),
 	}
 
 	// Настройка источника света
-	light = NewLight(
-		Vector{0, 1, -1},      // Направление света
-		1.0,                   // Интенсивность
-		Vector{1, 1, 1},       // Цвет диффузного света
-		Vector{1, 1, 1},       // Цвет зеркального света
-		Vector{0.2, 0.2, 0.2}, // Цвет фонового света
+	light := tracer.NewLight(
+		tracer.NewVector(0, 1, -1),      // Направление света
+		1.0,                             // Интенсивность
+		tracer.NewVector(1, 1, 1),       // Цвет диффузного света
+		tracer.NewVector(1, 1, 1),       // Цвет зеркального света
+		tracer.NewVector(0.2, 0.2, 0.2), // Цвет фонового света
 	)
+
+	return &tracer.Scene{
+		Objects: objects,
+		Light:   light,
+		Camera:  camera,
+	}
 }
 
-// Умножение цветов (покомпонентное)
-func multiplyColors(a, b Vector) Vector {
-	return Vector{a.X * b.X, a.Y * b.Y, a.Z * b.Z}
+// Структура игры
+type Game struct {
+	progressive    *tracer.Progressive // Прогрессивный рендер сцены
+	exrOptions     tracer.EXROptions   // Формат сохранения OpenEXR
+	saveKeyPressed bool                // Флаг нажатия клавиши сохранения
+
+	denoiser      tracer.Denoiser              // Шумоподавление для просмотра
+	showDenoised  bool                         // Применять шумоподавление
+	post          *tracer.PostStack            // Постобработка из файла сцены
+	processed     atomic.Pointer[tracer.Frame] // Последний кадр после шумоподавления и постобработки
+	processedPass int                          // Проход, для которого запущена обработка
+	processing    atomic.Bool                  // Обработка выполняется в фоне
+
+	pick          tracer.Pick   // Выбранный объект для инспектора
+	picked        bool          // Объект выбран
+	highlight     *ebiten.Image // Подсветка выбранного объекта поверх кадра
+	highlightPass int           // Проход, по которому построена подсветка
+
+	scene            *tracer.Scene     // Сцена с текущей камерой, во время движения опережает рендер
+	moving           bool              // Камера двигается: полный рендер остановлен, показывается предпросмотр
+	lastMove         time.Time         // Время последнего движения камеры
+	pressX, pressY   int               // Точка нажатия левой кнопки
+	cursorX, cursorY int               // Положение курсора на прошлом кадре перетаскивания
+	dragging         bool              // Левая кнопка перетаскивает камеру, а не фокусирует
+	preview          *ebiten.Image     // Последний готовый предпросмотр
+	previewJob       *tracer.RenderJob // Рендер предпросмотра в работе
+	previewFrame     *tracer.Frame     // Кадр, в который рисует previewJob
+	previewScene     *tracer.Scene     // Сцена, с которой запущен последний предпросмотр
+
+	base         *tracer.Scene       // Сцена, собранная программой и флагами, поверх неё применяется файл
+	sceneFile    *tracer.SceneFile   // Последний успешно загруженный файл сцены, nil - без файла
+	sceneWatcher *tracer.FileWatcher // Слежение за файлом сцены и файлами, на которые он ссылается
+	sceneError   string              // Ошибка последней перезагрузки сцены
+	lastPoll     time.Time           // Время последней проверки файлов сцены
+
+	showStats bool // Показывать статистику рендера
 }
 
-// Сложение цветов (покомпонентное)
-func addColors(a, b Vector) Vector {
-	return Vector{a.X + b.X, a.Y + b.Y, a.Z + b.Z}
+// processFrame применяет к кадру шумоподавление (если denoiser не nil) и постобработку.
+// Одинакова для окна и рендера без окна.
+func processFrame(frame *tracer.Frame, toneMapper tracer.ToneMapper, denoiser *tracer.Denoiser, post *tracer.PostStack) *tracer.Frame {
+	if denoiser != nil {
+		frame = denoiser.Denoise(frame, toneMapper)
+	}
+	if !post.Empty() {
+		frame = post.Apply(frame, toneMapper)
+	}
+	return frame
 }
 
-// Трассировка луча
-func traceRay(ray Ray) (Vector, *Vector, SceneObject, Vector) {
-	color := Vector{0, 0, 0} // Итоговый цвет
-	var normal Vector        // Нормаль в точке пересечения
-	var intersect *Vector    // Точка пересечения
-	var obj SceneObject      // Объект пересечения
-
-	// Проверка пересечения луча с объектами
-	point, obj, hit := ray.Cast(objects)
-	if hit {
-		intersect = &point.Point
-		normal = obj.GetNormal(point.Point)
-		material := obj.GetMaterial(point.Point)
-
-		// Фоновая составляющая (всегда присутствует)
-		ambient := multiplyColors(material.AmbientColor, light.AmbientColor)
-
-		// Инициализация диффузной и зеркальной составляющих
-		diffuse := Vector{0, 0, 0}
-		specular := Vector{0, 0, 0}
-
-		// Проверка нахождения точки в тени
-		lightDir := light.Direction.Neg().Normalize()
-		shadowRay := Ray{Origin: point.Point.Add(lightDir.Mul(0.001)), Direction: lightDir}
-		_, _, shadowHit := shadowRay.Cast(objects)
-
-		if !shadowHit {
-			// закон Ламберта
-			// Диффузная составляющая (только если не в тени)
-			diffuseIntensity := math.Max(0, normal.Dot(lightDir)) * light.Strength
-			diffuse = multiplyColors(material.DiffuseColor, light.DiffuseColor).Mul(diffuseIntensity)
-
-			// Зеркальная составляющая (только если не в тени)
-			viewDir := camera.Position.Sub(point.Point).Normalize()
-			reflectDir := normal.Mul(2 * normal.Dot(lightDir)).Sub(lightDir)
-			specularIntensity := math.Pow(math.Max(0, viewDir.Dot(reflectDir)), material.Shininess)
-			specular = multiplyColors(material.SpecularColor, light.SpecularColor).Mul(specularIntensity)
-		}
-
-		// Комбинирование всех составляющих
-		color = addColors(ambient, addColors(diffuse, specular))
-	} else {
-		// Если нет пересечения - цвет из скайбокса
-		color = skybox.GetImageCoords(ray.Direction)
+// processingEnabled сообщает, показывается ли обработанный кадр вместо накопленного
+func (g *Game) processingEnabled() bool {
+	return g.showDenoised || !g.post.Empty()
+}
+
+// shownFrame возвращает кадр, который сейчас на экране
+func (g *Game) shownFrame() *tracer.Frame {
+	if processed := g.processed.Load(); g.processingEnabled() && processed != nil {
+		return processed
+	}
+	return g.progressive.Frame()
+}
+
+// updateProcessed запускает в фоне обработку копии кадра, если с прошлого запуска появились новые проходы
+func (g *Game) updateProcessed() {
+	passes := g.progressive.Passes()
+	if passes == 0 || passes == g.processedPass || !g.processing.CompareAndSwap(false, true) {
+		return
 	}
+	g.processedPass = passes
 
-	return color, intersect, obj, normal
+	frame := g.progressive.Frame().Clone()
+	toneMapper := g.progressive.Renderer.ToneMapper
+	post := g.post // reloadScene заменяет стек, пока кадр обрабатывается
+	var denoiser *tracer.Denoiser
+	if g.showDenoised {
+		denoiser = &g.denoiser
+	}
+	go func() {
+		defer g.processing.Store(false)
+		g.processed.Store(processFrame(frame, toneMapper, denoiser, post))
+	}()
 }
 
-// Структура игры
-type Game struct {
-	rendered bool // Флаг завершения рендеринга
+// pickAt выбирает объект под курсором или снимает выбор, если там окружение
+func (g *Game) pickAt(x, y int) {
+	g.pick, g.picked = g.scene.Pick(tracer.NewVector(float64(x), float64(y), 0))
+	g.highlightPass = -1
+}
+
+// updateHighlight перестраивает подсветку выбранного объекта по проходу objectid,
+// если с прошлого раза кадр накопил новые проходы
+func (g *Game) updateHighlight() {
+	passes := g.progressive.Passes()
+	if !g.picked || passes == g.highlightPass {
+		return
+	}
+	g.highlightPass = passes
+
+	frame := g.progressive.Frame()
+	ids := frame.AOV(tracer.AOVObjectID)
+	if ids == nil {
+		return
+	}
+	if g.highlight == nil {
+		g.highlight = ebiten.NewImage(frame.Width, frame.Height)
+	}
+
+	selected := func(x, y int) bool {
+		return x >= 0 && x < frame.Width && y >= 0 && y < frame.Height && int(ids[2*(y*frame.Width+x)]) == g.pick.ID
+	}
+	pix := make([]byte, 4*frame.Width*frame.Height)
+	for y := 0; y < frame.Height; y++ {
+		for x := 0; x < frame.Width; x++ {
+			if !selected(x, y) {
+				continue
+			}
+			// Контур непрозрачный, внутренность слегка тонирована (альфа premultiplied)
+			c := []byte{60, 45, 0, 60}
+			if !selected(x-1, y) || !selected(x+1, y) || !selected(x, y-1) || !selected(x, y+1) {
+				c = []byte{255, 190, 0, 255}
+			}
+			copy(pix[4*(y*frame.Width+x):], c)
+		}
+	}
+	g.highlight.WritePixels(pix)
+}
+
+// drawInspector выводит параметры выбранного объекта на полупрозрачной панели в правом верхнем углу
+func (g *Game) drawInspector(screen *ebiten.Image) {
+	const charWidth, lineHeight, padding = 6, 16, 8
+
+	text := g.pick.Describe() + "\n(right click to pick, Esc to clear)"
+	lines := strings.Split(text, "\n")
+	width := 0
+	for _, line := range lines {
+		width = max(width, len(line))
+	}
+	panelWidth := float32(width*charWidth + 2*padding)
+	panelHeight := float32(len(lines)*lineHeight + 2*padding)
+	x := float32(screenWidth) - panelWidth - padding
+
+	vector.DrawFilledRect(screen, x, padding, panelWidth, panelHeight, color.RGBA{A: 180}, false)
+	ebitenutil.DebugPrintAt(screen, text, int(x)+padding, 2*padding)
+}
+
+// updateCamera двигает камеру клавиатурой и мышью: WASD - полёт, Q/E - вниз и вверх,
+// перетаскивание левой кнопкой - вращение вокруг точки фокуса, щелчок - фокусировка,
+// колесо - приближение, [ и ] - угол обзора
+func (g *Game) updateCamera() {
+	camera := g.scene.Camera
+
+	step := flySpeed / float64(ebiten.TPS())
+	if ebiten.IsKeyPressed(ebiten.KeyShift) {
+		step *= 4
+	}
+	// axis возвращает шаг по оси: +step для клавиши plus, -step для minus
+	axis := func(plus, minus ebiten.Key) float64 {
+		move := 0.0
+		if ebiten.IsKeyPressed(plus) {
+			move += step
+		}
+		if ebiten.IsKeyPressed(minus) {
+			move -= step
+		}
+		return move
+	}
+	right := axis(ebiten.KeyD, ebiten.KeyA)
+	down := axis(ebiten.KeyQ, ebiten.KeyE)
+	forward := axis(ebiten.KeyW, ebiten.KeyS)
+	if right != 0 || down != 0 || forward != 0 {
+		camera = camera.Fly(right, down, forward)
+	}
+
+	x, y := ebiten.CursorPosition()
+	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+		g.pressX, g.pressY = x, y
+		g.cursorX, g.cursorY = x, y
+		g.dragging = false
+	}
+	if ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft) {
+		if !g.dragging && max(abs(x-g.pressX), abs(y-g.pressY)) > dragThreshold {
+			g.dragging = true
+		}
+		if g.dragging && (x != g.cursorX || y != g.cursorY) {
+			camera = camera.OrbitBy(-float64(x-g.cursorX)*orbitSensitivity, float64(y-g.cursorY)*orbitSensitivity)
+		}
+		g.cursorX, g.cursorY = x, y
+	}
+	if inpututil.IsMouseButtonJustReleased(ebiten.MouseButtonLeft) && !g.dragging {
+		// Щелчок без перетаскивания фокусирует камеру на объекте под курсором
+		point := tracer.NewVector(float64(g.pressX), float64(g.pressY), 0)
+		if focused, ok := g.scene.WithCamera(camera).FocusAt(point); ok {
+			camera = focused.Camera
+		}
+	}
+
+	if _, wheel := ebiten.Wheel(); wheel != 0 {
+		camera = camera.Dolly(math.Pow(zoomStep, wheel))
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyBracketLeft) {
+		camera.FOV = math.Max(minFOV, camera.FOV-fovStep)
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyBracketRight) {
+		camera.FOV = math.Min(maxFOV, camera.FOV+fovStep)
+	}
+
+	if camera != g.scene.Camera {
+		g.scene = g.scene.WithCamera(camera)
+		g.lastMove = time.Now()
+		if !g.moving {
+			// Полный рендер прерывается: рабочие дорисовывают текущую строку тайла и выходят
+			g.moving = true
+			g.progressive.Stop()
+		}
+	}
+}
+
+// updatePreview показывает готовый предпросмотр, запускает следующий для новой камеры
+// и возвращается к полному рендеру, когда камера остановилась.
+// Предпросмотр не прерывается: одновременно рисуется только один, и следующий берёт последнюю камеру.
+func (g *Game) updatePreview() {
+	if g.previewJob != nil {
+		select {
+		case <-g.previewJob.Done():
+		default:
+			return
+		}
+		if g.previewJob.Wait() == nil {
+			if g.preview == nil {
+				g.preview = ebiten.NewImage(g.previewFrame.Width, g.previewFrame.Height)
+			}
+			g.preview.WritePixels(g.previewFrame.Image.Pix)
+		}
+		g.previewJob = nil
+	}
+	if !g.moving {
+		return
+	}
+
+	if g.previewScene != g.scene {
+		renderer := *g.progressive.Renderer
+		renderer.Scene = g.scene
+		g.previewFrame, g.previewJob = renderer.Preview(previewScale).Start(context.Background())
+		g.previewScene = g.scene
+		return
+	}
+
+	if time.Since(g.lastMove) > settleDelay {
+		g.moving = false
+		g.restart()
+	}
+}
+
+// restart начинает полный рендер сцены g.scene заново
+func (g *Game) restart() {
+	g.progressive.SetScene(g.scene)
+	g.processed.Store(nil) // Обработанный кадр снят с прежней сцены
+	g.processedPass = 0
+	g.highlightPass = -1
+}
+
+// reloadScene перечитывает файл сцены, если он или файлы, на которые он ссылается, изменились.
+// Ошибка показывается поверх кадра, а рендер продолжается с прежней сценой.
+// Камера из окна сохраняется, если в файле не менялся раздел camera.
+func (g *Game) reloadScene() {
+	if g.sceneWatcher == nil || time.Since(g.lastPoll) < scenePollInterval {
+		return
+	}
+	g.lastPoll = time.Now()
+	if !g.sceneWatcher.Changed() {
+		return
+	}
+
+	file, err := tracer.ReadSceneFile(g.sceneFile.Path())
+	if err == nil {
+		// Новые ссылки отслеживаются, даже если файл по ним ещё не загружается
+		g.sceneWatcher.Watch(file.Dependencies()...)
+		err = file.Load()
+	}
+	if err != nil {
+		g.sceneError = err.Error()
+		log.Printf("Ошибка перезагрузки сцены: %v", err)
+		return
+	}
+
+	scene := file.Scene(g.base)
+	if !file.CameraChanged(g.sceneFile) {
+		scene.Camera = g.scene.Camera
+	}
+	g.sceneFile = file
+	g.sceneError = ""
+	g.post = &file.Post
+	g.picked = false // Объекты построены заново
+	g.scene = scene
+	if !g.moving {
+		g.restart()
+	}
+	log.Printf("Сцена перезагружена из %s", file.Path())
+}
+
+// drawSceneError выводит ошибку загрузки сцены на панели внизу окна
+func (g *Game) drawSceneError(screen *ebiten.Image) {
+	const lineHeight, padding = 16, 8
+
+	text := "Scene reload failed, keeping the previous scene:\n" + g.sceneError
+	lines := strings.Count(text, "\n") + 1
+	height := float32(lines*lineHeight + 2*padding)
+	y := float32(screenHeight) - height - padding
+
+	vector.DrawFilledRect(screen, padding, y, float32(screenWidth-2*padding), height, color.RGBA{R: 120, A: 200}, false)
+	ebitenutil.DebugPrintAt(screen, text, 2*padding, int(y)+padding)
+}
+
+// drawStats выводит статистику полного рендера на полупрозрачной панели в левом нижнем углу
+func (g *Game) drawStats(screen *ebiten.Image) {
+	const charWidth, lineHeight, padding = 6, 16, 8
+
+	text := g.progressive.Renderer.Stats.Report().String()
+	lines := strings.Split(text, "\n")
+	width := 0
+	for _, line := range lines {
+		width = max(width, len(line))
+	}
+	panelWidth := float32(width*charWidth + 2*padding)
+	panelHeight := float32(len(lines)*lineHeight + 2*padding)
+	y := float32(screenHeight) - panelHeight - padding
+
+	vector.DrawFilledRect(screen, padding, y, panelWidth, panelHeight, color.RGBA{A: 180}, false)
+	ebitenutil.DebugPrintAt(screen, text, 2*padding, int(y)+padding)
+}
+
+// setDebugMode переключает отладочное отображение и перезапускает полный рендер
+func (g *Game) setDebugMode(mode tracer.DebugMode) {
+	renderer := g.progressive.Renderer
+	if renderer.Debug == mode {
+		return
+	}
+	g.progressive.Stop()
+	renderer.Debug = mode
+	g.progressive.Reset()
+	g.processed.Store(nil)
+	g.processedPass = 0
+	g.highlightPass = -1
+	g.previewScene = nil // Предпросмотр тоже перерисовывается в новом режиме
+}
+
+// showPreview сообщает, рисуется ли предпросмотр вместо накопленного кадра:
+// во время движения и пока полный рендер не закончил первый проход
+func (g *Game) showPreview() bool {
+	return g.preview != nil && (g.moving || g.progressive.Passes() == 0)
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
 }
 
 // Обновление состояния игры
 func (g *Game) Update() error {
-	if !g.rendered {
-		go renderScene() // Запуск рендеринга
-		g.rendered = true
+	if !g.moving {
+		g.progressive.Start(context.Background()) // Запуск рендеринга, если он ещё не идёт
+	}
+
+	// Обработка нажатия Ctrl+S для сохранения (S без Ctrl двигает камеру)
+	saveKeys := ebiten.IsKeyPressed(ebiten.KeyControl) && ebiten.IsKeyPressed(ebiten.KeyS)
+	if saveKeys && !g.saveKeyPressed {
+		g.saveKeyPressed = true
+		// Накопленный кадр рабочие продолжают дописывать, пока открыт диалог, поэтому сохраняется копия
+		frame := g.shownFrame()
+		if frame == g.progressive.Frame() {
+			frame = frame.Clone()
+		}
+		go saveImageWithDialog(frame, g.exrOptions)
+	} else if !saveKeys {
+		g.saveKeyPressed = false
+	}
+
+	// Экспозиция и оператор тональной компрессии меняются без перерендера
+	toneMapper := g.progressive.Renderer.ToneMapper
+	toneChanged := true
+	switch {
+	case inpututil.IsKeyJustPressed(ebiten.KeyEqual), inpututil.IsKeyJustPressed(ebiten.KeyKPAdd):
+		toneMapper.Exposure += 0.5
+	case inpututil.IsKeyJustPressed(ebiten.KeyMinus), inpututil.IsKeyJustPressed(ebiten.KeyKPSubtract):
+		toneMapper.Exposure -= 0.5
+	case inpututil.IsKeyJustPressed(ebiten.KeyT):
+		toneMapper.Operator = tracer.ToneOperators[(int(toneMapper.Operator)+1)%len(tracer.ToneOperators)]
+	default:
+		toneChanged = false
+	}
+	if toneChanged {
+		g.progressive.SetToneMapper(toneMapper)
+		// Обработанный кадр строится заново с новой компрессией
+		g.processedPass = 0
+	}
+
+	g.reloadScene()
+	if !saveKeys {
+		g.updateCamera()
+	}
+	g.updatePreview()
+
+	// Правая кнопка выбирает объект для инспектора, Esc снимает выбор
+	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonRight) {
+		g.pickAt(ebiten.CursorPosition())
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		g.picked = false
+	}
+	g.updateHighlight()
+
+	for i, key := range debugKeys {
+		if inpututil.IsKeyJustPressed(key) {
+			g.setDebugMode(tracer.DebugModes[i])
+		}
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyF3) {
+		g.showStats = !g.showStats
 	}
 
-	// Обработка нажатия клавиши S для сохранения
-	if ebiten.IsKeyPressed(ebiten.KeyS) && !saveKeyPressed {
-		saveKeyPressed = true
-		go func() {
-			saveImageWithDialog()
-			saveKeyPressed = false
-		}()
-	} else if !ebiten.IsKeyPressed(ebiten.KeyS) {
-		saveKeyPressed = false
+	if inpututil.IsKeyJustPressed(ebiten.KeyN) {
+		g.showDenoised = !g.showDenoised
+		g.processedPass = 0
+	}
+	if g.processingEnabled() {
+		g.updateProcessed()
 	}
 
 	return nil
@@ -208,10 +578,59 @@ func (g *Game) Update() error {
 
 // Отрисовка кадра
 func (g *Game) Draw(screen *ebiten.Image) {
-	if img != nil {
-		screen.ReplacePixels(img.Pix) // Обновление пикселей экрана
+	preview := g.showPreview()
+	if preview {
+		// Предпросмотр растягивается на всё окно
+		op := &ebiten.DrawImageOptions{Filter: ebiten.FilterLinear}
+		bounds := g.preview.Bounds()
+		op.GeoM.Scale(float64(screenWidth)/float64(bounds.Dx()), float64(screenHeight)/float64(bounds.Dy()))
+		screen.DrawImage(g.preview, op)
+	} else {
+		screen.ReplacePixels(g.shownFrame().Image.Pix) // Обновление пикселей экрана
+	}
+
+	toneMapper := g.progressive.Renderer.ToneMapper
+	status := "Go Raytracer - Progressive Rendering"
+	status += fmt.Sprintf("\nTone: %v, exposure %+.1f EV (T, +/-)", toneMapper.Operator, toneMapper.Exposure)
+	if g.showDenoised {
+		status += fmt.Sprintf("\nDenoise: on, strength %.1f (N)", g.denoiser.Strength)
+	} else {
+		status += "\nDenoise: off (N)"
+	}
+	if !g.post.Empty() {
+		status += "\nPost: on"
+	}
+	status += fmt.Sprintf("\nDebug: %v (0-%d)", g.progressive.Renderer.Debug, len(debugKeys)-1)
+	camera := g.scene.Camera
+	status += fmt.Sprintf("\nFocus: %.2f (click), FOV: %.0f ([ ])", camera.FocusDistance, camera.FOV)
+	status += "\nMove: WASD, Q/E, drag to orbit, wheel to zoom"
+	if !g.picked {
+		status += "\nInspect: right click"
+	}
+	if !g.showStats {
+		status += "\nStats: F3"
+	}
+	if preview {
+		status += "\nPreview"
+	} else if g.progressive.TargetSamples > 0 {
+		status += fmt.Sprintf("\nPass: %d/%d", g.progressive.Passes(), g.progressive.TargetSamples)
+	} else {
+		status += fmt.Sprintf("\nPass: %d", g.progressive.Passes())
+	}
+	ebitenutil.DebugPrint(screen, status)
+
+	if g.picked {
+		if g.highlight != nil && g.highlightPass > 0 && !preview {
+			screen.DrawImage(g.highlight, nil)
+		}
+		g.drawInspector(screen)
+	}
+	if g.showStats {
+		g.drawStats(screen)
+	}
+	if g.sceneError != "" {
+		g.drawSceneError(screen)
 	}
-	ebitenutil.DebugPrint(screen, "Go Raytracer - Progressive Rendering")
 }
 
 // Установка размера окна
@@ -219,9 +638,10 @@ func (g *Game) Layout(outsideWidth, outsideHeight int) (int, int) {
 	return screenWidth, screenHeight
 }
 
-// Сохранение изображения через диалоговое окно
-func saveImageWithDialog() {
-	if img == nil {
+// Сохранение кадра через диалоговое окно. Формат выбирается по расширению:
+// PNG для отображаемого изображения, EXR, HDR и PFM для линейной яркости
+func saveImageWithDialog(frame *tracer.Frame, exr tracer.EXROptions) {
+	if frame == nil {
 		return
 	}
 
@@ -229,6 +649,9 @@ func saveImageWithDialog() {
 	filename, err := dialog.File().
 		Title("Save Image").
 		Filter("PNG Image", "png").
+		Filter("OpenEXR Image", "exr").
+		Filter("Radiance HDR Image", "hdr").
+		Filter("Portable Float Map", "pfm").
 		SetStartDir(".").
 		Save()
 
@@ -240,7 +663,8 @@ func saveImageWithDialog() {
 	}
 
 	// Добавление расширения .png при необходимости
-	if !strings.HasSuffix(strings.ToLower(filename), ".png") {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if ext != ".png" && !slices.Contains(tracer.HDRExtensions, ext) {
 		filename += ".png"
 	}
 
@@ -253,106 +677,412 @@ func saveImageWithDialog() {
 		}
 	}
 
-	// Создание файла
-	file, err := os.Create(filename)
-	if err != nil {
-		log.Printf("Ошибка создания файла: %v", err)
+	if err := tracer.SaveFrame(filename, frame, exr); err != nil {
+		log.Printf("Ошибка сохранения изображения: %v", err)
 		return
 	}
-	defer file.Close()
 
-	// Сохранение изображения в формате PNG
-	if err := png.Encode(file, img); err != nil {
-		log.Printf("Ошибка кодирования PNG: %v", err)
-		return
+	log.Printf("Изображение успешно сохранено в %s", filename)
+}
+
+// Конвертация окружения: равнопромежуточная панорама сохраняется крестом куба,
+// куб и процедурное небо - панорамой
+func convertEnvironment(env tracer.Environment, filename string, size int) error {
+	var width, height int
+	var rgb []float32
+	switch env := env.(type) {
+	case *tracer.Skybox:
+		width, height, rgb = tracer.NewCubemapFromEnvironment(env, size).Cross()
+	case *tracer.Cubemap, *tracer.ProceduralSky:
+		width, height, rgb = tracer.NewSkyboxFromEnvironment(env, 2*size, size).Radiance()
+	default:
+		return fmt.Errorf("cannot convert environment %T", env)
 	}
 
-	log.Printf("Изображение успешно сохранено в %s", filename)
+	frame := tracer.NewFrameFromRadiance(width, height, rgb, tracer.NewToneMapper())
+	return tracer.SaveFrame(filename, frame, tracer.NewEXROptions())
 }
 
-// Рендеринг сцены
-func renderScene() {
-	rand.Seed(time.Now().UnixNano())
-	img = image.NewRGBA(image.Rect(0, 0, screenWidth, screenHeight))
-
-	// Параллельный рендеринг по строкам
-	for i := 0; i < screenHeight/gorutineLines; i++ {
-		i := i
-		go func() {
-			for y := i * gorutineLines; y < (i+1)*gorutineLines; y++ {
-				for x := 0; x < screenWidth; x++ {
-					colorSum := Vector{0, 0, 0}
-
-					// Сэмплирование для антиалиасинга
-					for s := 0; s < samplesPerPixel; s++ {
-						jx := float64(x) + rand.Float64() - 0.5
-						jy := float64(y) + rand.Float64() - 0.5
-
-						ray := camera.GetDirection(Vector{jx, jy, 0})
-						color, intersect, _, normal := traceRay(ray)
-
-						if intersect != nil {
-							// Обработка отражений
-							reflectionDir := ray.Direction.Reflect(normal)
-							reflectionRay := Ray{
-								Origin:    intersect.Add(reflectionDir.Mul(shadowBias)),
-								Direction: reflectionDir,
-							}
-
-							reflectionColor := Vector{0, 0, 0}
-							reflectionTimes := 0
-
-							// Рекурсивная трассировка отражений
-							for r := 0; r < maxReflections; r++ {
-								newColor, newIntersect, _, newNormal := traceRay(reflectionRay)
-								if newIntersect != nil {
-									reflectionColor = reflectionColor.Add(newColor)
-									reflectionTimes++
-									newReflectionDir := reflectionRay.Direction.Reflect(newNormal)
-									reflectionRay = Ray{
-										Origin:    newIntersect.Add(newReflectionDir.Mul(shadowBias)),
-										Direction: newReflectionDir,
-									}
-								} else {
-									break
-								}
-							}
-
-							if reflectionTimes > 0 {
-								color = color.Add(reflectionColor.Div(float64(reflectionTimes)))
-							}
-						}
-
-						colorSum = colorSum.Add(color)
-					}
-
-					// Усреднение цвета по сэмплам
-					avgColor := colorSum.Div(float64(samplesPerPixel))
-					r, g, b := avgColor.ToRGB()
-					img.Set(x, y, color.RGBA{
-						R: uint8(r),
-						G: uint8(g),
-						B: uint8(b),
-						A: 255,
-					})
-				}
-			}
-		}()
+// Количество сэмплов на пиксель, которое рендер наберёт на самом деле: окно делает targetSamples
+// проходов, адаптивное сэмплирование останавливается на своём максимуме. По нему стратифицированный
+// сэмплер выбирает сетку страт; для окна без ограничения проходов берётся unboundedSamples.
+func pixelSamples(renderer *tracer.Renderer, window bool, targetSamples int) int {
+	switch {
+	case !window && renderer.Adaptive != nil:
+		return renderer.Adaptive.MaxSamples
+	case !window:
+		return renderer.SamplesPerPixel
+	}
+
+	samples := targetSamples
+	if renderer.Adaptive != nil && (samples <= 0 || renderer.Adaptive.MaxSamples < samples) {
+		samples = renderer.Adaptive.MaxSamples
+	}
+	if samples <= 0 {
+		samples = unboundedSamples
+	}
+	return samples
+}
+
+// Разбор точки экрана из строки вида "x,y"
+func parsePoint(s string) (int, int, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("expected x,y, got %q", s)
 	}
+
+	var p [2]int
+	for i, part := range parts {
+		v, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid point coordinate %q: %w", part, err)
+		}
+		p[i] = v
+	}
+	if p[0] < 0 || p[0] >= screenWidth || p[1] < 0 || p[1] >= screenHeight {
+		return 0, 0, fmt.Errorf("point %d,%d is outside the %dx%d frame", p[0], p[1], screenWidth, screenHeight)
+	}
+	return p[0], p[1], nil
+}
+
+// Разбор вектора из строки вида "x,y,z"
+func parseVector(s string) (tracer.Vector, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 3 {
+		return tracer.Vector{}, fmt.Errorf("expected x,y,z, got %q", s)
+	}
+
+	var v [3]float64
+	for i, part := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return tracer.Vector{}, fmt.Errorf("invalid vector component %q: %w", part, err)
+		}
+		v[i] = f
+	}
+	return tracer.NewVector(v[0], v[1], v[2]), nil
+}
+
+// debugModeList перечисляет отладочные режимы через запятую для справки по флагам
+func debugModeList() string {
+	names := make([]string, len(tracer.DebugModes))
+	for i, m := range tracer.DebugModes {
+		names[i] = m.String()
+	}
+	return strings.Join(names, ", ")
+}
+
+// profiled выполняет run, записывая профиль процессора в файл path, если он задан.
+// Профиль останавливается и закрывается и тогда, когда run вернул ошибку.
+func profiled(path string, run func() error) error {
+	if path == "" {
+		return run()
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("Не удалось создать файл профиля: %w", err)
+	}
+	defer f.Close()
+	if err := pprof.StartCPUProfile(f); err != nil {
+		return fmt.Errorf("Не удалось запустить профилирование: %w", err)
+	}
+	defer func() {
+		pprof.StopCPUProfile()
+		log.Printf("Профиль процессора сохранён в %s", path)
+	}()
+	return run()
 }
 
 func main() {
-	initScene()
-	skybox, _ = NewSkybox("windows.png")
+	scene := initScene()
+	renderer := tracer.NewRenderer(scene, screenWidth, screenHeight)
+
+	// Параметры облёта камеры (turntable)
+	turntable := flag.Bool("turntable", false, "Отрендерить облёт камеры без окна")
+	orbitTarget := flag.String("orbit-target", "0,-1,-10", "Точка, вокруг которой вращается камера (x,y,z)")
+	turntableOpts := tracer.TurntableOptions{}
+	flag.Float64Var(&turntableOpts.Radius, "orbit-radius", 20, "Радиус орбиты камеры")
+	flag.Float64Var(&turntableOpts.Elevation, "orbit-elevation", 15, "Угол возвышения камеры в градусах")
+	flag.Float64Var(&turntableOpts.Revolutions, "orbit-revolutions", 1, "Количество оборотов камеры")
+	flag.IntVar(&turntableOpts.Frames, "frames", 36, "Количество кадров облёта")
+	flag.IntVar(&turntableOpts.Delay, "frame-delay", 8, "Задержка между кадрами GIF в сотых долях секунды")
+	flag.StringVar(&turntableOpts.Output, "out", "turntable.gif", "GIF файл или каталог для PNG кадров")
+
+	// Параметры планировщика тайлов
+	scheduler := &renderer.Scheduler
+	flag.IntVar(&scheduler.TileSize, "tile-size", scheduler.TileSize, "Размер тайла в пикселях")
+	flag.IntVar(&scheduler.Workers, "workers", scheduler.Workers, "Количество рабочих горутин")
+	tileOrder := flag.String("tile-order", scheduler.Order.String(), "Порядок тайлов: scanline, hilbert или spiral")
+
+	// Параметры рендера
+	flag.IntVar(&renderer.SamplesPerPixel, "samples", renderer.SamplesPerPixel, "Сэмплов на пиксель при рендере без окна")
+	targetSamples := flag.Int("target-samples", 64, "Количество проходов прогрессивного рендера (0 - без ограничения)")
+	output := flag.String("render", "", "Отрендерить один кадр без окна в файл (.png, .exr, .hdr или .pfm)")
+	exrType := flag.String("exr-type", "half", "Тип каналов OpenEXR: half или float")
+	exrCompression := flag.String("exr-compression", "zip", "Сжатие OpenEXR: none или zip")
+	filterName := flag.String("filter", renderer.Filter.Type.String(), "Фильтр восстановления пикселей: box, tent, gaussian, mitchell или lanczos")
+	filterRadius := flag.Float64("filter-radius", 0, "Радиус фильтра восстановления в пикселях (0 - по умолчанию для фильтра)")
+	flag.IntVar(&scene.Camera.Bokeh.Blades, "blades", 0, "Лепестков диафрагмы, форма размытых бликов (0 - круглая)")
+	flag.Float64Var(&scene.Camera.Bokeh.Rotation, "blade-rotation", 0, "Поворот диафрагмы или её маски в градусах")
+	focusOn := flag.String("focus-on", "", "Сфокусироваться на объекте в пикселе x,y")
+	apertureMask := flag.String("aperture-mask", "", "Изображение формы диафрагмы, яркость - пропускание (заменяет -blades)")
+	flag.Float64Var(&scene.Camera.Bokeh.CatEye, "cat-eye", 0, "Обрезание диафрагмы оправой у углов кадра в радиусах апертуры (0 - выключено)")
+	samplerName := flag.String("sampler", "independent", "Сэмплер: "+strings.Join(tracer.SamplerNames, ", "))
+	seed := flag.Int64("seed", 0, "Seed случайных чисел для повторяемого рендера (по умолчанию случайный)")
+
+	// Параметры адаптивного сэмплирования
+	adaptiveThreshold := flag.Float64("adaptive-threshold", 0, "Полуширина доверительного интервала яркости пикселя (0 - без адаптивного сэмплирования)")
+	adaptiveMin := flag.Int("adaptive-min", 4, "Минимум сэмплов на пиксель при адаптивном сэмплировании")
+	adaptiveMax := flag.Int("adaptive-max", 64, "Максимум сэмплов на пиксель при адаптивном сэмплировании")
+	denoiseStrength := flag.Float64("denoise", 0, fmt.Sprintf("Сила шумоподавления по альбедо, нормалям и глубине (0 - выключено, обычно %d); в окне переключается клавишей N", tracer.DefaultDenoiseStrength))
+	denoiseIterations := flag.Int("denoise-iterations", 5, "Проходов фильтра шумоподавления, радиус растёт до 2^N пикселей")
+	aovList := flag.String("aov", "", "Дополнительные проходы при рендере без окна через запятую или all: depth, normal, albedo, objectid, direct, indirect, shadow, reflection, ao")
+	aovFiles := flag.Bool("aov-files", false, "Сохранять проходы отдельными файлами, даже если кадр сохраняется в .exr (иначе - слоями того же файла)")
+	scenePath := flag.String("scene", "", "Файл сцены (JSON): камера, свет, окружение, объекты и постобработка; окно перезагружает его при изменении")
+	heatmap := flag.String("heatmap", "", "PNG файл для карты количества сэмплов по пикселям")
+	debugMode := flag.String("debug", tracer.DebugOff.String(), "Отладочное отображение вместо освещения: "+debugModeList())
+	flag.Float64Var(&renderer.DebugDepth, "debug-depth", 0, "Расстояние, на котором режим depth даёт серый 50% (0 - фокусное расстояние)")
+	cpuProfile := flag.String("cpuprofile", "", "Записать профиль процессора в файл (смотреть через go tool pprof)")
+
+	// Параметры тональной компрессии
+	toneOperator := flag.String("tonemap", renderer.ToneMapper.Operator.String(), "Оператор тональной компрессии: clamp, reinhard, reinhard-extended, hable или aces")
+	flag.Float64Var(&renderer.ToneMapper.Exposure, "exposure", 0, "Экспозиция в ступенях (EV)")
+	flag.Float64Var(&renderer.ToneMapper.WhitePoint, "white-point", renderer.ToneMapper.WhitePoint, "Яркость, которая становится белой (reinhard-extended, hable)")
 
-	// Настройка окна
-	ebiten.SetWindowSize(screenWidth, screenHeight)
-	ebiten.SetWindowTitle("Go Raytracer - Progressive Rendering (Press S to save)")
-	ebiten.SetWindowResizingMode(ebiten.WindowResizingModeDisabled)
+	// Параметры окружения
+	envPath := flag.String("env", "", "Окружение: панорама или крест (.hdr или 8-битное изображение), либо 6 граней куба через запятую (+X,-X,+Y,-Y,+Z,-Z). По умолчанию - процедурное небо")
+	envLayout := flag.String("env-layout", "auto", "Раскладка изображения окружения: auto, equirect или cross")
+	envConvert := flag.String("env-convert", "", "Сохранить окружение в другом виде и выйти: панораму крестом куба, куб и процедурное небо - панорамой")
+	envConvertSize := flag.Int("env-convert-size", 512, "Размер грани куба или высота панорамы при конвертации окружения")
+	envRotation := flag.Float64("env-rotation", 0, "Поворот изображения окружения вокруг вертикальной оси в градусах")
+	envIntensity := flag.Float64("env-intensity", 1, "Множитель яркости окружения")
+	sunElevation := flag.Float64("sun-elevation", 45, "Высота солнца процедурного неба над горизонтом в градусах")
+	sunAzimuth := flag.Float64("sun-azimuth", 0, "Азимут солнца процедурного неба в градусах (0 - за камерой)")
+	sunIntensity := flag.Float64("sun-intensity", 1, "Сила солнца процедурного неба как источника света")
+	turbidity := flag.Float64("turbidity", tracer.DefaultTurbidity, "Мутность атмосферы процедурного неба (2 - ясно, 10 - дымка)")
+	aoSamples := flag.Int("ao-samples", 0, fmt.Sprintf("Лучей окклюзии постоянного фонового света на точку (0 - без окклюзии, обычно %d); освещение окружением (-env-samples > 0) затеняется само", tracer.DefaultOcclusionSamples))
+	aoDistance := flag.Float64("ao-distance", tracer.DefaultOcclusionDistance, "Дальность лучей окклюзии: препятствия дальше не затеняют")
+	flag.IntVar(&renderer.EnvironmentSamples, "env-samples", 1, "Направлений на окружение при освещении точки (0 - окружение не светит)")
+	flag.Parse()
 
-	// Запуск игры
-	game := &Game{}
-	if err := ebiten.RunGame(game); err != nil {
+	order, err := tracer.ParseTileOrder(*tileOrder)
+	if err != nil {
+		log.Fatalf("Некорректный порядок тайлов: %v", err)
+	}
+	scheduler.Order = order
+
+	layout, err := tracer.ParseEnvironmentLayout(*envLayout)
+	if err != nil {
+		log.Fatalf("Некорректная раскладка окружения: %v", err)
+	}
+	if *envPath != "" {
+		env, err := tracer.LoadEnvironment(*envPath, tracer.EnvironmentOptions{
+			Layout:    layout,
+			Rotation:  *envRotation,
+			Intensity: *envIntensity,
+		})
+		if err != nil {
+			log.Fatalf("Не удалось загрузить окружение: %v", err)
+		}
+		scene.Skybox = env
+	} else {
+		// Без изображения - процедурное небо, солнце которого заменяет источник света сцены
+		sky := tracer.NewProceduralSky(*sunElevation, *sunAzimuth, *turbidity)
+		sky.Intensity = *envIntensity
+		sky.SunIntensity = *sunIntensity
+		scene.Skybox = sky
+		scene.Light = sky.SunLight()
+	}
+
+	if *apertureMask != "" {
+		scene.Camera.Bokeh.Mask, err = tracer.LoadApertureMask(*apertureMask)
+		if err != nil {
+			log.Fatalf("Не удалось загрузить маску диафрагмы: %v", err)
+		}
+	}
+
+	// Разделы файла сцены заменяют сцену, собранную программой и флагами
+	var sceneFile *tracer.SceneFile
+	var post *tracer.PostStack
+	if *scenePath != "" {
+		sceneFile, err = tracer.LoadSceneFile(*scenePath)
+		if err != nil {
+			log.Fatalf("Ошибка загрузки файла сцены: %v", err)
+		}
+		renderer.Scene = sceneFile.Scene(scene)
+		post = &sceneFile.Post
+	}
+
+	if *envConvert != "" {
+		if err := convertEnvironment(renderer.Scene.Skybox, *envConvert, *envConvertSize); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Окружение сохранено в %s", *envConvert)
+		return
+	}
+
+	// Всё дальнейшее выполняется под профилировщиком: при ошибке профиль закрывается до выхода
+	run := func() error {
+		renderer.Stats = tracer.NewRenderStats()
+
+		// Без явного seed рендер каждый раз разный
+		seedSet := false
+		flag.Visit(func(f *flag.Flag) { seedSet = seedSet || f.Name == "seed" })
+		if !seedSet {
+			*seed = time.Now().UnixNano()
+		}
+		log.Printf("Seed: %d", *seed)
+
+		renderer.ToneMapper.Operator, err = tracer.ParseToneOperator(*toneOperator)
+		if err != nil {
+			return fmt.Errorf("Некорректный оператор тональной компрессии: %w", err)
+		}
+
+		renderer.Debug, err = tracer.ParseDebugMode(*debugMode)
+		if err != nil {
+			return fmt.Errorf("Некорректный отладочный режим: %w", err)
+		}
+
+		filterType, err := tracer.ParseFilterType(*filterName)
+		if err != nil {
+			return fmt.Errorf("Некорректный фильтр восстановления: %w", err)
+		}
+		renderer.Filter = tracer.NewFilter(filterType, *filterRadius)
+
+		if *focusOn != "" {
+			x, y, err := parsePoint(*focusOn)
+			if err != nil {
+				return fmt.Errorf("Некорректная точка фокуса: %w", err)
+			}
+			focused, ok := renderer.Scene.FocusAt(tracer.NewVector(float64(x), float64(y), 0))
+			if !ok {
+				return fmt.Errorf("В пикселе %d,%d нет объекта для фокусировки", x, y)
+			}
+			renderer.Scene = focused
+			log.Printf("Фокусное расстояние: %.3f", focused.Camera.FocusDistance)
+		}
+
+		exrOptions, err := tracer.ParseEXROptions(*exrType, *exrCompression)
+		if err != nil {
+			return fmt.Errorf("Некорректный формат OpenEXR: %w", err)
+		}
+
+		if *aoSamples > 0 {
+			renderer.Occlusion = tracer.NewAmbientOcclusion(*aoSamples, *aoDistance)
+			if renderer.EnvironmentSamples > 0 && renderer.Scene.Skybox != nil {
+				log.Printf("Окружение светит вместо постоянного фонового света, -ao-samples влияет только на проход ao и режим отладки ao (-env-samples 0 отключает освещение окружением)")
+			}
+		}
+
+		if *adaptiveThreshold > 0 {
+			renderer.Adaptive = tracer.NewAdaptiveSampling(*adaptiveMin, *adaptiveMax, *adaptiveThreshold)
+		}
+
+		window := *output == "" && !*turntable
+		renderer.Sampler, err = tracer.NewSampler(*samplerName, pixelSamples(renderer, window, *targetSamples), *seed)
+		if err != nil {
+			return fmt.Errorf("Некорректный сэмплер: %w", err)
+		}
+
+		renderer.AOVs, err = tracer.ParseAOVs(*aovList)
+		if err != nil {
+			return fmt.Errorf("Некорректный список проходов: %w", err)
+		}
+
+		denoiser := tracer.NewDenoiser(*denoiseStrength)
+		denoiser.Iterations = *denoiseIterations
+		if *denoiseStrength <= 0 {
+			denoiser.Strength = tracer.DefaultDenoiseStrength
+		}
+
+		// Шумоподавление без окна включается только флагом -denoise
+		var headlessDenoiser *tracer.Denoiser
+		if *denoiseStrength > 0 {
+			headlessDenoiser = &denoiser
+		}
+
+		if *output != "" {
+			start := time.Now()
+			frame, err := renderer.Render(context.Background())
+			if err != nil {
+				return err
+			}
+			log.Printf("Кадр отрендерен за %v", time.Since(start).Round(time.Millisecond))
+			log.Printf("Статистика рендера:\n%v", renderer.Stats.Report())
+
+			frame = processFrame(frame, renderer.ToneMapper, headlessDenoiser, post)
+
+			layered := len(renderer.AOVs) > 0 && !*aovFiles && strings.EqualFold(filepath.Ext(*output), ".exr")
+			if layered {
+				err = tracer.SaveLayeredEXR(*output, frame, renderer.AOVs, exrOptions)
+			} else {
+				err = tracer.SaveFrame(*output, frame, exrOptions)
+			}
+			if err != nil {
+				return err
+			}
+			if !layered && len(renderer.AOVs) > 0 {
+				saved, err := tracer.SaveAOVs(*output, frame, renderer.AOVs, renderer.ToneMapper, exrOptions)
+				if err != nil {
+					return err
+				}
+				log.Printf("Проходы сохранены в %s", strings.Join(saved, ", "))
+			}
+			if *heatmap != "" {
+				if err := tracer.SavePNG(*heatmap, frame.SampleHeatmap()); err != nil {
+					return err
+				}
+			}
+			log.Printf("Изображение сохранено в %s", *output)
+			return nil
+		}
+
+		if *turntable {
+			target, err := parseVector(*orbitTarget)
+			if err != nil {
+				return fmt.Errorf("Некорректная точка облёта: %w", err)
+			}
+			turntableOpts.Target = target
+			turntableOpts.Process = func(frame *tracer.Frame) *tracer.Frame {
+				return processFrame(frame, renderer.ToneMapper, headlessDenoiser, post)
+			}
+
+			if err := renderer.RenderTurntable(context.Background(), turntableOpts); err != nil {
+				return err
+			}
+			log.Printf("Статистика рендера по всем кадрам:\n%v", renderer.Stats.Report())
+			log.Printf("Облёт сохранён в %s", turntableOpts.Output)
+			return nil
+		}
+
+		// Настройка окна
+		ebiten.SetWindowSize(screenWidth, screenHeight)
+		ebiten.SetWindowTitle("Go Raytracer - Progressive Rendering (Press Ctrl+S to save)")
+		ebiten.SetWindowResizingMode(ebiten.WindowResizingModeDisabled)
+
+		// Проход objectid нужен окну для подсветки выбранного объекта
+		if !slices.Contains(renderer.AOVs, tracer.AOVObjectID) {
+			renderer.AOVs = append(renderer.AOVs, tracer.AOVObjectID)
+		}
+
+		// Запуск игры
+		game := &Game{
+			progressive: tracer.NewProgressive(renderer, *targetSamples),
+			scene:       renderer.Scene,
+			base:        scene,
+			sceneFile:   sceneFile,
+			exrOptions:  exrOptions,
+
+			denoiser:     denoiser,
+			showDenoised: *denoiseStrength > 0,
+			post:         post,
+		}
+		if sceneFile != nil {
+			game.sceneWatcher = tracer.NewFileWatcher(sceneFile.Dependencies()...)
+		}
+		return ebiten.RunGame(game)
+	}
+	if err := profiled(*cpuProfile, run); err != nil {
 		log.Fatal(err)
 	}
 }
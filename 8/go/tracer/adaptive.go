@@ -0,0 +1,122 @@
+package tracer
+
+import "math"
+
+// AdaptiveSampling задаёт адаптивное сэмплирование: пиксель досэмплируется,
+// пока доверительный интервал его яркости шире порога
+type AdaptiveSampling struct {
+	MinSamples int     // Сэмплов до первой оценки дисперсии
+	MaxSamples int     // Предел сэмплов на пиксель
+	Threshold  float64 // Допустимая полуширина доверительного интервала яркости
+	Z          float64 // Квантиль нормального распределения (1.96 для 95%)
+}
+
+// NewAdaptiveSampling создаёт настройки с 95% доверительным интервалом
+func NewAdaptiveSampling(minSamples, maxSamples int, threshold float64) *AdaptiveSampling {
+	return &AdaptiveSampling{
+		MinSamples: max(minSamples, 2),
+		MaxSamples: max(maxSamples, minSamples),
+		Threshold:  threshold,
+		Z:          1.96,
+	}
+}
+
+// pixelStats накапливает сумму цвета и дисперсию яркости пикселя (алгоритм Уэлфорда),
+// а также сумму признаков первого пересечения и число попаданий в объекты
+type pixelStats struct {
+	sum      Vector
+	n        int
+	mean     float64
+	m2       float64
+	features Features
+	objects  [4]objectCoverage // Объекты с наибольшим числом сэмплов, остальные не учитываются
+}
+
+// objectCoverage - число сэмплов пикселя, попавших в объект
+type objectCoverage struct {
+	id, count int
+}
+
+func (s *pixelStats) add(c Vector, f Features) {
+	s.sum = s.sum.Add(c)
+	s.features = Features{
+		Albedo:     s.features.Albedo.Add(f.Albedo),
+		Normal:     s.features.Normal.Add(f.Normal),
+		Depth:      s.features.Depth + f.Depth,
+		Direct:     s.features.Direct.Add(f.Direct),
+		Indirect:   s.features.Indirect.Add(f.Indirect),
+		Shadow:     s.features.Shadow.Add(f.Shadow),
+		Reflection: s.features.Reflection.Add(f.Reflection),
+		AO:         s.features.AO + f.AO,
+	}
+	for i := range s.objects {
+		if o := &s.objects[i]; o.count == 0 || o.id == f.Object {
+			o.id = f.Object
+			o.count++
+			break
+		}
+	}
+	s.n++
+	l := c.Luminance()
+	delta := l - s.mean
+	s.mean += delta / float64(s.n)
+	s.m2 += delta * (l - s.mean)
+}
+
+// color возвращает средний цвет пикселя
+func (s *pixelStats) color() Vector {
+	if s.n == 0 {
+		return Vector{0, 0, 0}
+	}
+	return s.sum.Div(float64(s.n))
+}
+
+// averageFeatures возвращает признаки, усреднённые по сэмплам пикселя
+func (s *pixelStats) averageFeatures() Features {
+	if s.n == 0 {
+		return skyFeatures
+	}
+	n := float64(s.n)
+	dominant := s.objects[0]
+	for _, o := range s.objects[1:] {
+		if o.count > dominant.count {
+			dominant = o
+		}
+	}
+	return Features{
+		Albedo:     s.features.Albedo.Mul(1 / n),
+		Normal:     s.features.Normal.Mul(1 / n),
+		Depth:      s.features.Depth / n,
+		Object:     dominant.id,
+		Coverage:   float64(dominant.count) / n,
+		Direct:     s.features.Direct.Mul(1 / n),
+		Indirect:   s.features.Indirect.Mul(1 / n),
+		Shadow:     s.features.Shadow.Mul(1 / n),
+		Reflection: s.features.Reflection.Mul(1 / n),
+		AO:         s.features.AO / n,
+	}
+}
+
+// meanVariance возвращает дисперсию средней яркости пикселя, -1 если сэмплов меньше двух
+func (s *pixelStats) meanVariance() float64 {
+	if s.n < 2 {
+		return -1
+	}
+	return s.m2 / float64(s.n-1) / float64(s.n)
+}
+
+// halfWidth возвращает полуширину доверительного интервала средней яркости
+func (s *pixelStats) halfWidth(z float64) float64 {
+	if s.n < 2 {
+		return math.Inf(1)
+	}
+	return z * math.Sqrt(s.meanVariance())
+}
+
+// done сообщает, можно ли прекратить сэмплирование пикселя
+func (a *AdaptiveSampling) done(s *pixelStats) bool {
+	if s.n >= a.MaxSamples {
+		return true
+	}
+	return s.n >= a.MinSamples && s.halfWidth(a.Z) <= a.Threshold
+}
@@ -0,0 +1,322 @@
+package tracer
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Features - признаки и составляющие яркости первого пересечения луча.
+// По диффузному цвету, нормали и глубине денойзер находит края, из остального собираются AOV.
+type Features struct {
+	Albedo   Vector  // Диффузный цвет материала
+	Normal   Vector  // Нормаль поверхности
+	Depth    float64 // Расстояние от камеры
+	Object   int     // Номер объекта (Scene.ObjectID), 0 - окружение
+	Coverage float64 // Доля сэмплов пикселя, попавших в Object (у усреднённых признаков)
+
+	Direct     Vector // Свет источника
+	Indirect   Vector // Фоновый свет или освещение окружением
+	Shadow     Vector // Свет источника, перекрытый тенью
+	Reflection Vector // Яркость, добавленная отражениями
+
+	AO float64 // Доля незакрытых направлений полусферы, 1 - точка открыта
+}
+
+// skyFeatures - признаки луча, ушедшего в окружение: белый цвет, без нормали и глубины, ничем не закрыт
+var skyFeatures = Features{Albedo: Vector{1, 1, 1}, AO: 1}
+
+// AOV - дополнительный проход рендера для композитинга.
+// Яркость кадра складывается из direct, indirect и reflection, а для промахов - из окружения.
+type AOV int
+
+const (
+	AOVDepth      AOV = iota // Расстояние от камеры, 0 для окружения
+	AOVNormal                // Нормаль в мировых координатах
+	AOVAlbedo                // Диффузный цвет
+	AOVObjectID              // Номер преобладающего объекта и доля покрытых им сэмплов
+	AOVDirect                // Свет источника
+	AOVIndirect              // Фоновый свет или освещение окружением
+	AOVShadow                // Свет источника, перекрытый тенью
+	AOVReflection            // Отражения
+	AOVOcclusion             // Окклюзия фонового света: 1 - открыто, 0 - закрыто
+)
+
+var aovNames = map[AOV]string{
+	AOVDepth:      "depth",
+	AOVNormal:     "normal",
+	AOVAlbedo:     "albedo",
+	AOVObjectID:   "objectid",
+	AOVDirect:     "direct",
+	AOVIndirect:   "indirect",
+	AOVShadow:     "shadow",
+	AOVReflection: "reflection",
+	AOVOcclusion:  "ao",
+}
+
+// AOVs - все проходы в порядке записи
+var AOVs = []AOV{AOVDepth, AOVNormal, AOVAlbedo, AOVObjectID, AOVDirect, AOVIndirect, AOVShadow, AOVReflection, AOVOcclusion}
+
+func (a AOV) String() string {
+	if name, ok := aovNames[a]; ok {
+		return name
+	}
+	return fmt.Sprintf("AOV(%d)", int(a))
+}
+
+// ParseAOVs разбирает список проходов через запятую; "all" - все проходы
+func ParseAOVs(list string) ([]AOV, error) {
+	if list == "" {
+		return nil, nil
+	}
+	if list == "all" {
+		return slices.Clone(AOVs), nil
+	}
+
+	var aovs []AOV
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		i := slices.IndexFunc(AOVs, func(a AOV) bool { return a.String() == name })
+		if i < 0 {
+			names := make([]string, len(AOVs))
+			for j, a := range AOVs {
+				names[j] = a.String()
+			}
+			return nil, fmt.Errorf("unknown AOV %q (expected all or %s)", name, strings.Join(names, ", "))
+		}
+		if !slices.Contains(aovs, AOVs[i]) {
+			aovs = append(aovs, AOVs[i])
+		}
+	}
+	return aovs, nil
+}
+
+// Channels возвращает названия каналов прохода
+func (a AOV) Channels() []string {
+	switch a {
+	case AOVDepth:
+		return []string{"Z"}
+	case AOVNormal:
+		return []string{"X", "Y", "Z"}
+	case AOVObjectID:
+		return []string{"id", "coverage"}
+	case AOVOcclusion:
+		return []string{"Y"}
+	default:
+		return []string{"R", "G", "B"}
+	}
+}
+
+// features сообщает, хранится ли проход среди признаков денойзера, которые кадр собирает всегда
+func (a AOV) features() bool {
+	return a == AOVDepth || a == AOVNormal || a == AOVAlbedo
+}
+
+// EnableAOVs выделяет буферы для проходов, которых нет среди признаков кадра
+func (f *Frame) EnableAOVs(aovs []AOV) {
+	for _, a := range aovs {
+		if a.features() {
+			continue
+		}
+		if f.AOVs == nil {
+			f.AOVs = make(map[AOV][]float32)
+		}
+		if f.AOVs[a] == nil {
+			f.AOVs[a] = make([]float32, len(a.Channels())*f.Width*f.Height)
+		}
+	}
+}
+
+// AOV возвращает значения прохода, по len(a.Channels()) на пиксель, или nil, если проход не собирался
+func (f *Frame) AOV(a AOV) []float32 {
+	switch a {
+	case AOVDepth:
+		return f.Depth
+	case AOVNormal:
+		return f.Normal
+	case AOVAlbedo:
+		return f.Albedo
+	}
+	return f.AOVs[a]
+}
+
+// setAOVs записывает собираемые проходы пикселя i
+func (f *Frame) setAOVs(i int, features Features) {
+	for a, data := range f.AOVs {
+		var c Vector
+		switch a {
+		case AOVObjectID:
+			data[2*i] = float32(features.Object)
+			data[2*i+1] = float32(features.Coverage)
+			continue
+		case AOVOcclusion:
+			data[i] = float32(features.AO)
+			continue
+		case AOVDirect:
+			c = features.Direct
+		case AOVIndirect:
+			c = features.Indirect
+		case AOVShadow:
+			c = features.Shadow
+		case AOVReflection:
+			c = features.Reflection
+		}
+		data[3*i] = float32(c.X)
+		data[3*i+1] = float32(c.Y)
+		data[3*i+2] = float32(c.Z)
+	}
+}
+
+// aovData возвращает проход или ошибку, если он не собирался
+func (f *Frame) aovData(a AOV) ([]float32, error) {
+	data := f.AOV(a)
+	if data == nil {
+		return nil, fmt.Errorf("AOV %v was not rendered", a)
+	}
+	return data, nil
+}
+
+// objectColor - случайный, но постоянный цвет объекта для просмотра прохода objectid
+func objectColor(id int) Vector {
+	if id <= 0 {
+		return Vector{0, 0, 0}
+	}
+	h := hashUint32(uint32(id))
+	return Vector{float64(h&0xff) / 255, float64(h>>8&0xff) / 255, float64(h>>16&0xff) / 255}
+}
+
+// aovRGB переводит проход в три линейных канала для форматов без произвольных каналов:
+// глубина повторяется в каждом канале, номер объекта заменяется его цветом с учётом покрытия
+func (f *Frame) aovRGB(a AOV) ([]float32, error) {
+	data, err := f.aovData(a)
+	if err != nil {
+		return nil, err
+	}
+
+	switch a {
+	case AOVDepth, AOVOcclusion:
+		rgb := make([]float32, 0, 3*len(data))
+		for _, d := range data {
+			rgb = append(rgb, d, d, d)
+		}
+		return rgb, nil
+	case AOVObjectID:
+		rgb := make([]float32, 0, 3*f.Width*f.Height)
+		for i := 0; i < f.Width*f.Height; i++ {
+			c := objectColor(int(data[2*i])).Mul(float64(data[2*i+1]))
+			rgb = append(rgb, float32(c.X), float32(c.Y), float32(c.Z))
+		}
+		return rgb, nil
+	}
+	return data, nil
+}
+
+// AOVImage возвращает 8-битное изображение прохода для просмотра: глубина - светлее ближе, окружение чёрное,
+// нормаль - 0.5 + 0.5n, составляющие яркости - с тональной компрессией tm
+func (f *Frame) AOVImage(a AOV, tm ToneMapper) (*image.RGBA, error) {
+	rgb, err := f.aovRGB(a)
+	if err != nil {
+		return nil, err
+	}
+
+	// Глубина сжимается кривой d / (d + средняя глубина), чтобы бесконечная плоскость не скрыла объекты
+	meanDepth, hits := 0.0, 0
+	for _, d := range f.Depth {
+		if d > 0 {
+			meanDepth += float64(d)
+			hits++
+		}
+	}
+	meanDepth /= float64(max(hits, 1))
+
+	img := image.NewRGBA(image.Rect(0, 0, f.Width, f.Height))
+	for i := 0; i < f.Width*f.Height; i++ {
+		c := Vector{float64(rgb[3*i]), float64(rgb[3*i+1]), float64(rgb[3*i+2])}
+		switch a {
+		case AOVDepth:
+			if c.X > 0 {
+				v := 1 - c.X/(c.X+meanDepth)
+				c = Vector{v, v, v}
+			}
+		case AOVNormal:
+			c = c.Mul(0.5).Add(0.5)
+		case AOVAlbedo:
+			img.SetRGBA(i%f.Width, i/f.Width, NewToneMapper().Encode(c))
+			continue
+		case AOVDirect, AOVIndirect, AOVShadow, AOVReflection:
+			img.SetRGBA(i%f.Width, i/f.Width, tm.Encode(c))
+			continue
+		}
+		r, g, b := c.ToRGB()
+		img.SetRGBA(i%f.Width, i/f.Width, color.RGBA{R: uint8(math.Round(r)), G: uint8(math.Round(g)), B: uint8(math.Round(b)), A: 255})
+	}
+	return img, nil
+}
+
+// AOVChannels возвращает проходы каналами многослойного OpenEXR: "depth.Z", "normal.X" и т.д.
+func (f *Frame) AOVChannels(aovs []AOV) ([]EXRChannel, error) {
+	var channels []EXRChannel
+	for _, a := range aovs {
+		data, err := f.aovData(a)
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, layerChannels(a.String(), a.Channels(), data)...)
+	}
+	return channels, nil
+}
+
+// SaveLayeredEXR сохраняет яркость кадра и проходы aovs слоями одного файла OpenEXR
+func SaveLayeredEXR(filename string, frame *Frame, aovs []AOV, exr EXROptions) error {
+	channels, err := frame.AOVChannels(aovs)
+	if err != nil {
+		return err
+	}
+	channels = append(RGBChannels("", frame.Radiance), channels...)
+	return writeFile(filename, func(w io.Writer) error {
+		return WriteEXR(w, frame.Width, frame.Height, channels, exr)
+	})
+}
+
+// SaveAOVs сохраняет каждый проход отдельным файлом рядом с filename: render.png даёт
+// render.depth.png, render.normal.png и т.д. Формат выбирается по расширению, как в SaveFrame.
+// Возвращает имена записанных файлов.
+func SaveAOVs(filename string, frame *Frame, aovs []AOV, tm ToneMapper, exr EXROptions) ([]string, error) {
+	ext := filepath.Ext(filename)
+	base := strings.TrimSuffix(filename, ext)
+
+	var saved []string
+	for _, a := range aovs {
+		name := base + "." + a.String() + ext
+		var err error
+		switch strings.ToLower(ext) {
+		case ".exr":
+			var data []float32
+			if data, err = frame.aovData(a); err == nil {
+				err = writeFile(name, func(w io.Writer) error {
+					return WriteEXR(w, frame.Width, frame.Height, layerChannels("", a.Channels(), data), exr)
+				})
+			}
+		case ".hdr", ".pfm":
+			var rgb []float32
+			if rgb, err = frame.aovRGB(a); err == nil {
+				err = saveRadiance(name, frame.Width, frame.Height, rgb, exr)
+			}
+		default:
+			var img *image.RGBA
+			if img, err = frame.AOVImage(a, tm); err == nil {
+				err = SavePNG(name, img)
+			}
+		}
+		if err != nil {
+			return saved, err
+		}
+		saved = append(saved, name)
+	}
+	return saved, nil
+}
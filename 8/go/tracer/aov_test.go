@@ -0,0 +1,74 @@
+package tracer
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+// Составляющие яркости в сумме дают кадр, а проход objectid находит объекты сцены
+func TestAOVs(t *testing.T) {
+	const width, height = 48, 24
+
+	scene := testScene(width, height)
+	// Свет сзади слева, чтобы тень шара падала в кадр
+	scene.Light.Direction = Vector{1, 1, 1}
+	r := NewRenderer(scene, width, height)
+	r.SamplesPerPixel = 2
+	r.Sampler = NewIndependentSampler(1)
+	r.AOVs = AOVs
+	frame, err := r.Render(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := frame.AOV(AOVObjectID)
+	direct, indirect, reflection := frame.AOV(AOVDirect), frame.AOV(AOVIndirect), frame.AOV(AOVReflection)
+	found := map[int]bool{}
+	for i := 0; i < width*height; i++ {
+		id, coverage := int(ids[2*i]), ids[2*i+1]
+		found[id] = true
+		if id == 0 || coverage < 1 {
+			continue
+		}
+		for c := 3 * i; c < 3*i+3; c++ {
+			if sum := direct[c] + indirect[c] + reflection[c]; abs32(sum-frame.Radiance[c]) > 1e-5 {
+				t.Fatalf("pixel %d: direct + indirect + reflection = %g, radiance %g", i, sum, frame.Radiance[c])
+			}
+		}
+	}
+	if slices.Max(frame.AOV(AOVShadow)) <= 0 {
+		t.Errorf("shadow pass is empty")
+	}
+	for id := 0; id <= len(r.Scene.Objects); id++ {
+		if !found[id] {
+			t.Errorf("object id %d not found in the objectid pass", id)
+		}
+	}
+
+	channels, err := frame.AOVChannels([]AOV{AOVDepth, AOVNormal, AOVObjectID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, c := range channels {
+		names = append(names, c.Name)
+	}
+	want := []string{"depth.Z", "normal.X", "normal.Y", "normal.Z", "objectid.id", "objectid.coverage"}
+	if !slices.Equal(names, want) {
+		t.Errorf("channels %v, want %v", names, want)
+	}
+
+	// Без запроса дополнительные буферы не выделяются
+	r.AOVs = nil
+	if frame, _ := r.Render(context.Background()); frame.AOV(AOVShadow) != nil {
+		t.Errorf("shadow pass rendered without being requested")
+	}
+}
+
+func abs32(v float32) float32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,154 @@
+package tracer
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"os"
+)
+
+// Bokeh - форма диафрагмы, которую повторяют размытые блики вне фокуса
+type Bokeh struct {
+	Blades   int           // Лепестков диафрагмы, меньше 3 - круглое отверстие
+	Rotation float64       // Поворот многоугольника или маски в градусах
+	Mask     *ApertureMask // Форма из изображения, если задана - заменяет круг и многоугольник
+	CatEye   float64       // Сдвиг оправы у угла кадра в радиусах апертуры, 0 - без "кошачьего глаза"
+}
+
+// catEyeAttempts - сколько раз ищется точка линзы внутри оправы, прежде чем взять середину просвета
+const catEyeAttempts = 8
+
+// Sample возвращает точку диафрагмы единичного радиуса для сэмпла (u, v) из [0, 1).
+// Точки распределены равномерно по площади отверстия (для маски - пропорционально её пропусканию).
+func (b Bokeh) Sample(u, v float64) (float64, float64) {
+	var x, y float64
+	switch {
+	case b.Mask != nil:
+		x, y = b.Mask.Sample(u, v)
+	case b.Blades >= 3:
+		x, y = samplePolygon(b.Blades, u, v)
+	default:
+		return concentricDisk(u, v) // Круг не меняется при повороте
+	}
+
+	if b.Rotation == 0 {
+		return x, y
+	}
+	sin, cos := math.Sincos(degreesToRadians(b.Rotation))
+	return x*cos - y*sin, x*sin + y*cos
+}
+
+// sampleVignetted возвращает точку диафрагмы для пикселя, смещённого на (sx, sy) от центра кадра
+// в долях половины диагонали (1 - угол кадра). С CatEye у краёв отверстие обрезается оправой линзы - единичным кругом,
+// сдвинутым к центру кадра, и блики принимают форму кошачьего глаза.
+func (b Bokeh) sampleVignetted(sx, sy, u, v float64) (float64, float64) {
+	if b.CatEye <= 0 {
+		return b.Sample(u, v)
+	}
+	cx, cy := -sx*b.CatEye, -sy*b.CatEye
+
+	for i := 0; i < catEyeAttempts; i++ {
+		x, y := b.Sample(u, v)
+		if (x-cx)*(x-cx)+(y-cy)*(y-cy) <= 1 {
+			return x, y
+		}
+		// Сдвиг Кранли-Паттерсона по последовательности R2 сохраняет стратификацию сэмплов
+		u = math.Mod(u+0.7548776662466927, 1)
+		v = math.Mod(v+0.5698402909980532, 1)
+	}
+	// Середина между центрами диафрагмы и оправы лежит в просвете, пока он не пуст
+	return cx / 2, cy / 2
+}
+
+// concentricDisk равномерно отображает квадрат на единичный круг, сохраняя соседство точек
+// (Shirley, Chiu, "A Low Distortion Map Between Disk and Square")
+func concentricDisk(u, v float64) (float64, float64) {
+	a, b := 2*u-1, 2*v-1
+	if a == 0 && b == 0 {
+		return 0, 0
+	}
+
+	var r, theta float64
+	if math.Abs(a) > math.Abs(b) {
+		r, theta = a, math.Pi/4*(b/a)
+	} else {
+		r, theta = b, math.Pi/2-math.Pi/4*(a/b)
+	}
+	return r * math.Cos(theta), r * math.Sin(theta)
+}
+
+// samplePolygon равномерно выбирает точку правильного многоугольника, вписанного в единичный круг.
+// u выбирает треугольник между центром и стороной, затем переиспользуется внутри него.
+func samplePolygon(blades int, u, v float64) (float64, float64) {
+	n := float64(blades)
+	side := min(int(u*n), blades-1)
+	u = u*n - float64(side)
+
+	a0 := 2 * math.Pi * float64(side) / n
+	a1 := 2 * math.Pi * float64(side+1) / n
+	su := math.Sqrt(u)
+	w0, w1 := su*(1-v), su*v
+	return w0*math.Cos(a0) + w1*math.Cos(a1), w0*math.Sin(a0) + w1*math.Sin(a1)
+}
+
+// ApertureMask - диафрагма произвольной формы из изображения: яркость пикселя задаёт пропускание.
+// Большая сторона изображения занимает диаметр единичного круга.
+type ApertureMask struct {
+	width, height int
+	rowCDF        []float64   // Функция распределения строк, height+1 значений
+	columnCDF     [][]float64 // Функции распределения пикселей внутри строк
+}
+
+// LoadApertureMask читает маску диафрагмы из изображения
+func LoadApertureMask(path string) (*ApertureMask, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open aperture mask: %w", err)
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode aperture mask: %w", err)
+	}
+	mask, err := NewApertureMask(img)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return mask, nil
+}
+
+// NewApertureMask строит маску по линейной яркости изображения
+func NewApertureMask(img image.Image) (*ApertureMask, error) {
+	width, height, rgb := imageRadiance(img)
+	m := &ApertureMask{
+		width:     width,
+		height:    height,
+		rowCDF:    make([]float64, height+1),
+		columnCDF: make([][]float64, height),
+	}
+
+	// Функции распределения устроены как у Skybox и разбираются тем же sampleCDF
+	for y := 0; y < height; y++ {
+		cdf := make([]float64, width+1)
+		for x := 0; x < width; x++ {
+			i := y*width + x
+			cdf[x+1] = cdf[x] + Vector{float64(rgb[3*i]), float64(rgb[3*i+1]), float64(rgb[3*i+2])}.Luminance()
+		}
+		m.columnCDF[y] = cdf
+		m.rowCDF[y+1] = m.rowCDF[y] + cdf[width]
+	}
+	if m.rowCDF[height] <= 0 {
+		return nil, fmt.Errorf("aperture mask is completely black")
+	}
+	return m, nil
+}
+
+// Sample выбирает точку маски пропорционально пропусканию: сначала строку, затем пиксель в ней
+func (m *ApertureMask) Sample(u, v float64) (float64, float64) {
+	y, fy := sampleCDF(m.rowCDF, v)
+	x, fx := sampleCDF(m.columnCDF[y], u)
+
+	scale := 2 / float64(max(m.width, m.height))
+	return (float64(x) + fx - float64(m.width)/2) * scale, (float64(y) + fy - float64(m.height)/2) * scale
+}
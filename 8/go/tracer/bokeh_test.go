@@ -0,0 +1,140 @@
+package tracer
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+// bokehGrid возвращает точки диафрагмы для сетки n×n сэмплов в центрах ячеек
+func bokehGrid(n int, sample func(u, v float64) (float64, float64)) [][2]float64 {
+	points := make([][2]float64, 0, n*n)
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			x, y := sample((float64(i)+0.5)/float64(n), (float64(j)+0.5)/float64(n))
+			points = append(points, [2]float64{x, y})
+		}
+	}
+	return points
+}
+
+// innerFraction возвращает долю точек ближе 0.5 к центру
+func innerFraction(points [][2]float64) float64 {
+	inner := 0
+	for _, p := range points {
+		if math.Hypot(p[0], p[1]) < 0.5 {
+			inner++
+		}
+	}
+	return float64(inner) / float64(len(points))
+}
+
+func TestBokehShapes(t *testing.T) {
+	const n = 64
+
+	t.Run("disk", func(t *testing.T) {
+		points := bokehGrid(n, Bokeh{}.Sample)
+		for _, p := range points {
+			if math.Hypot(p[0], p[1]) > 1+1e-9 {
+				t.Fatalf("point %v outside the unit disk", p)
+			}
+		}
+		// Равномерно по площади: в круге половинного радиуса - четверть точек
+		if got := innerFraction(points); math.Abs(got-0.25) > 0.02 {
+			t.Errorf("inner fraction %.3f, want 0.25", got)
+		}
+	})
+
+	t.Run("hexagon", func(t *testing.T) {
+		bokeh := Bokeh{Blades: 6, Rotation: 30}
+		points := bokehGrid(n, bokeh.Sample)
+		// Апофема шестиугольника, вписанного в единичный круг, - cos 30°;
+		// после поворота на 30° стороны перпендикулярны углам 0°, 60°, ...
+		apothem := math.Cos(math.Pi / 6)
+		for _, p := range points {
+			for k := 0; k < 6; k++ {
+				sin, cos := math.Sincos(float64(k) * math.Pi / 3)
+				if p[0]*cos+p[1]*sin > apothem+1e-9 {
+					t.Fatalf("point %v outside the hexagon", p)
+				}
+			}
+		}
+		want := math.Pi / 4 / (3 * math.Sqrt(3) / 2)
+		if got := innerFraction(points); math.Abs(got-want) > 0.02 {
+			t.Errorf("inner fraction %.3f, want %.3f", got, want)
+		}
+	})
+
+	t.Run("mask", func(t *testing.T) {
+		// Пропускает только левую половину
+		img := image.NewGray(image.Rect(0, 0, 8, 8))
+		for y := 0; y < 8; y++ {
+			for x := 0; x < 4; x++ {
+				img.SetGray(x, y, color.Gray{Y: 255})
+			}
+		}
+		mask, err := NewApertureMask(img)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		meanY := 0.0
+		points := bokehGrid(n, Bokeh{Mask: mask}.Sample)
+		for _, p := range points {
+			if p[0] > 0 || p[0] < -1 || math.Abs(p[1]) > 1 {
+				t.Fatalf("point %v outside the transparent half", p)
+			}
+			meanY += p[1] / float64(len(points))
+		}
+		if math.Abs(meanY) > 0.01 {
+			t.Errorf("mean y %.3f, want 0", meanY)
+		}
+
+		if _, err := NewApertureMask(image.NewGray(image.Rect(0, 0, 4, 4))); err == nil {
+			t.Error("black mask accepted")
+		}
+	})
+
+	t.Run("cat eye", func(t *testing.T) {
+		bokeh := Bokeh{CatEye: 1}
+		center := bokehGrid(n, func(u, v float64) (float64, float64) { return bokeh.sampleVignetted(0, 0, u, v) })
+		if got := innerFraction(center); math.Abs(got-0.25) > 0.02 {
+			t.Errorf("center of the frame: inner fraction %.3f, want 0.25", got)
+		}
+
+		// У правого нижнего угла оправа сдвинута к центру кадра
+		sx, sy := math.Sqrt(0.5), math.Sqrt(0.5)
+		corner := bokehGrid(n, func(u, v float64) (float64, float64) { return bokeh.sampleVignetted(sx, sy, u, v) })
+		for _, p := range corner {
+			if math.Hypot(p[0], p[1]) > 1+1e-9 || math.Hypot(p[0]+sx, p[1]+sy) > 1+1e-9 {
+				t.Fatalf("point %v outside the cat-eye opening", p)
+			}
+		}
+	})
+}
+
+// TestCameraFocus проверяет, что лучи из любой точки диафрагмы сходятся в точке фокуса
+func TestCameraFocus(t *testing.T) {
+	camera := NewCamera(Vector{1, -2, 5}, Vector{64, 32, 0}, 60, 7, 0.8).LookAt(Vector{0, 0, -5})
+	camera.Bokeh = Bokeh{Blades: 5, Rotation: 10, CatEye: 0.5}
+
+	for _, xy := range []Vector{{32, 16, 0}, {0, 0, 0}, {63, 31, 0}} {
+		pinhole := camera
+		pinhole.Aperture = 0
+		center := pinhole.GenerateRay(xy, 0.5, 0.5)
+		focus := center.Origin.Add(center.Direction.Mul(camera.FocusDistance))
+
+		for _, uv := range [][2]float64{{0.1, 0.2}, {0.9, 0.5}, {0.45, 0.95}} {
+			ray := camera.GenerateRay(xy, uv[0], uv[1])
+			if ray.Origin.Sub(camera.Position).Magnitude() < 1e-3 {
+				t.Errorf("pixel %v, lens sample %v: ray starts at the lens center", xy, uv)
+			}
+			// Ближайшая к фокусу точка луча
+			t0 := focus.Sub(ray.Origin).Dot(ray.Direction)
+			if d := ray.Origin.Add(ray.Direction.Mul(t0)).Sub(focus).Magnitude(); d > 1e-6 {
+				t.Errorf("pixel %v, lens sample %v: ray misses the focus point by %g", xy, uv, d)
+			}
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package tracer
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+type Camera struct {
+	Position      Vector
+	ScreenSize    Vector
+	FOV           float64
+	FocusDistance float64
+	Aperture      float64   // Диаметр линзы
+	Bokeh         Bokeh     // Форма диафрагмы
+	Orientation   Matrix4x4 // Поворот из системы камеры в мировую
+}
+
+func NewCamera(position, screenSize Vector, fov float64, focusDistance float64, aperture float64) Camera {
+	return Camera{
+		Position:      position,
+		ScreenSize:    screenSize,
+		FOV:           fov,
+		FocusDistance: focusDistance,
+		Aperture:      aperture,
+		Orientation:   Identity(),
+	}
+}
+
+func (c Camera) String() string {
+	return fmt.Sprintf("Camera(position: %v, screen_size: %v, fov: %.1f, focus_distance: %.1f, aperture: %.2f)",
+		c.Position, c.ScreenSize, c.FOV, c.FocusDistance, c.Aperture)
+}
+
+// LookAt возвращает камеру, направленную из текущей позиции на target.
+// Экранная ось Y камеры смотрит вниз, как и мировая ось +Y сцены.
+func (c Camera) LookAt(target Vector) Camera {
+	forward := target.Sub(c.Position).Normalize()
+	down := Vector{0, 1, 0}
+	if math.Abs(forward.Dot(down)) > 0.999 {
+		down = Vector{0, 0, 1} // Взгляд строго вверх или вниз
+	}
+	right := forward.Cross(down).Normalize()
+	down = right.Cross(forward).Normalize()
+
+	c.Orientation = FromBasis(right, down, forward.Neg())
+	return c
+}
+
+// Orbit ставит камеру на окружность радиуса radius вокруг target.
+// azimuth и elevation задаются в градусах, положительное возвышение поднимает камеру над целью.
+func (c Camera) Orbit(target Vector, radius, azimuth, elevation float64) Camera {
+	az := degreesToRadians(azimuth)
+	el := degreesToRadians(elevation)
+	c.Position = target.Add(Vector{
+		radius * math.Cos(el) * math.Sin(az),
+		-radius * math.Sin(el),
+		radius * math.Cos(el) * math.Cos(az),
+	})
+	return c.LookAt(target)
+}
+
+// Forward возвращает направление взгляда камеры
+func (c Camera) Forward() Vector {
+	return c.Orientation.MulVector(Vector{0, 0, -1})
+}
+
+// Pivot возвращает точку фокуса перед камерой, вокруг которой она вращается в OrbitBy
+func (c Camera) Pivot() Vector {
+	return c.Position.Add(c.Forward().Mul(c.FocusDistance))
+}
+
+// Fly сдвигает камеру в её собственных осях: вправо, вниз (по экранной оси Y) и вперёд
+func (c Camera) Fly(right, down, forward float64) Camera {
+	c.Position = c.Position.Add(c.Orientation.MulVector(Vector{right, down, -forward}))
+	return c
+}
+
+// OrbitBy поворачивает камеру вокруг Pivot на azimuth и elevation градусов.
+// Возвышение ограничено, чтобы камера не перевернулась над целью.
+func (c Camera) OrbitBy(azimuth, elevation float64) Camera {
+	pivot := c.Pivot()
+	offset := c.Position.Sub(pivot)
+	radius := offset.Magnitude()
+	if radius < 1e-9 {
+		return c
+	}
+
+	az := math.Atan2(offset.X, offset.Z) * 180 / math.Pi
+	el := math.Asin(math.Max(-1, math.Min(1, -offset.Y/radius))) * 180 / math.Pi
+	return c.Orbit(pivot, radius, az+azimuth, math.Max(-89, math.Min(89, el+elevation)))
+}
+
+// Dolly приближает камеру к Pivot в factor раз (factor > 1 - отдаляет), сохраняя фокус на нём
+func (c Camera) Dolly(factor float64) Camera {
+	pivot := c.Pivot()
+	c.FocusDistance = math.Max(1e-3, c.FocusDistance*factor)
+	c.Position = pivot.Sub(c.Forward().Mul(c.FocusDistance))
+	return c
+}
+
+// GetDirection строит луч через точку экрана xy со случайной точкой на линзе
+func (c Camera) GetDirection(xy Vector) Ray {
+	return c.GenerateRay(xy, rand.Float64(), rand.Float64())
+}
+
+// GenerateRay строит луч через точку экрана xy. Точка на линзе задаётся сэмплом (u, v) из [0, 1).
+func (c Camera) GenerateRay(xy Vector, u, v float64) Ray {
+	// Original direction calculation
+	adjustedXY := xy.Sub(c.ScreenSize.Div(Vector{2, 2, 2}))
+	z := c.ScreenSize.Y / math.Tan(degreesToRadians(c.FOV)/2)
+	direction := c.Orientation.MulVector(Vector{adjustedXY.X, adjustedXY.Y, -z}).Normalize()
+
+	var origin Vector
+	var finalDirection Vector
+
+	// Depth of field simulation
+	if c.Aperture > 0 {
+		// Point within aperture
+		halfDiagonal := c.ScreenSize.Magnitude() / 2
+		lx, ly := c.Bokeh.sampleVignetted(adjustedXY.X/halfDiagonal, adjustedXY.Y/halfDiagonal, u, v)
+		r := c.Aperture / 2
+		rd := c.Orientation.MulVector(Vector{lx * r, ly * r, 0})
+
+		focalPoint := c.Position.Add(direction.Mul(c.FocusDistance))
+		finalDirection = focalPoint.Sub(c.Position.Add(rd)).Normalize()
+		origin = c.Position.Add(rd)
+	} else {
+		finalDirection = direction
+		origin = c.Position
+	}
+
+	return NewRay(origin, finalDirection)
+}
+
+func degreesToRadians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
@@ -0,0 +1,84 @@
+package tracer
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func TestCameraNavigation(t *testing.T) {
+	camera := NewCamera(Vector{0, -2, 10}, Vector{64, 32, 0}, 60, 12, 0).LookAt(Vector{0, -1, -2})
+	pivot := camera.Pivot()
+	near := func(a, b Vector) bool { return a.Sub(b).Magnitude() < 1e-6 }
+
+	t.Run("fly", func(t *testing.T) {
+		moved := camera.Fly(0, 0, 2)
+		if !near(moved.Position, camera.Position.Add(camera.Forward().Mul(2))) {
+			t.Errorf("flying forward moved the camera to %v", moved.Position)
+		}
+		// Ось Y камеры смотрит вниз, как мировая +Y
+		if down := camera.Fly(0, 1, 0).Position.Sub(camera.Position); down.Y <= 0 {
+			t.Errorf("flying down moved the camera by %v", down)
+		}
+		if moved.Orientation != camera.Orientation {
+			t.Error("flying rotated the camera")
+		}
+	})
+
+	t.Run("orbit", func(t *testing.T) {
+		for _, step := range [][2]float64{{30, 0}, {-90, 20}, {0, 200}} {
+			orbited := camera.OrbitBy(step[0], step[1])
+			if !near(orbited.Pivot(), pivot) {
+				t.Errorf("orbit by %v moved the pivot from %v to %v", step, pivot, orbited.Pivot())
+			}
+			if d := orbited.Position.Sub(pivot).Magnitude(); math.Abs(d-camera.FocusDistance) > 1e-6 {
+				t.Errorf("orbit by %v changed the distance to %.6f", step, d)
+			}
+			if step[1] > 90 && orbited.Forward().Y < math.Sin(degreesToRadians(88)) {
+				t.Errorf("orbit by %v: elevation is not clamped near the top, forward %v", step, orbited.Forward())
+			}
+		}
+		if back := camera.OrbitBy(40, 10).OrbitBy(-40, -10); !near(back.Position, camera.Position) {
+			t.Errorf("orbit there and back ended at %v, want %v", back.Position, camera.Position)
+		}
+	})
+
+	t.Run("dolly", func(t *testing.T) {
+		closer := camera.Dolly(0.5)
+		if !near(closer.Pivot(), pivot) || math.Abs(closer.FocusDistance-6) > 1e-9 {
+			t.Errorf("dolly: pivot %v, focus distance %.3f", closer.Pivot(), closer.FocusDistance)
+		}
+	})
+}
+
+func TestRendererPreview(t *testing.T) {
+	const width, height = 48, 24
+	r := NewRenderer(testScene(width, height), width, height)
+	r.AOVs = []AOV{AOVObjectID}
+	r.Adaptive = NewAdaptiveSampling(4, 16, 0.01)
+
+	preview := r.Preview(4)
+	if preview.Width != 12 || preview.Height != 6 || preview.SamplesPerPixel != 1 || preview.Adaptive != nil || preview.AOVs != nil {
+		t.Fatalf("preview %dx%d, %d spp, adaptive %v, AOVs %v", preview.Width, preview.Height, preview.SamplesPerPixel, preview.Adaptive, preview.AOVs)
+	}
+	if r.Width != width || r.Scene.Camera.ScreenSize.X != width {
+		t.Fatal("Preview modified the original renderer")
+	}
+
+	// Кадрирование сохраняется: центр предпросмотра смотрит туда же, куда центр полного кадра
+	full := r.Scene.Camera.GenerateRay(Vector{width / 2, height / 2, 0}, 0.5, 0.5)
+	small := preview.Scene.Camera.GenerateRay(Vector{6, 3, 0}, 0.5, 0.5)
+	if full.Direction.Sub(small.Direction).Magnitude() > 1e-9 {
+		t.Errorf("preview center looks at %v, full frame at %v", small.Direction, full.Direction)
+	}
+
+	frame, err := preview.Render(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, n := range frame.Samples {
+		if n != 1 {
+			t.Fatalf("pixel %d got %d samples, want 1", i, n)
+		}
+	}
+}
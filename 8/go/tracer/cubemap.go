@@ -0,0 +1,228 @@
+package tracer
+
+import (
+	"fmt"
+	"math"
+)
+
+// Грани куба в порядке OpenGL
+const (
+	FacePosX = iota
+	FaceNegX
+	FacePosY
+	FaceNegY
+	FacePosZ
+	FaceNegZ
+)
+
+// Cubemap - окружение из шести квадратных граней в линейных значениях.
+// Грани следуют соглашению OpenGL (левая система: +Y вверх, +Z вперёд);
+// камера по умолчанию смотрит на грань +Z.
+type Cubemap struct {
+	size  int
+	faces [6][]float32 // Линейная яркость граней, по три канала на пиксель
+
+	Rotation  float64 // Поворот вокруг вертикальной оси в градусах
+	Intensity float64 // Множитель яркости
+
+	distribution *Skybox // Панорама без поворота для выбора направлений по яркости
+}
+
+// NewCubemap создаёт окружение из граней размером size x size в порядке +X, -X, +Y, -Y, +Z, -Z
+func NewCubemap(size int, faces [6][]float32) *Cubemap {
+	c := &Cubemap{size: size, faces: faces, Intensity: 1}
+
+	// Распределение строится по панораме, пока поворот нулевой, а яркость единичная
+	height := min(2*size, 512)
+	c.distribution = NewSkyboxFromEnvironment(c, 2*height, height)
+	return c
+}
+
+// NewCubemapFromFiles загружает шесть граней из отдельных файлов в порядке +X, -X, +Y, -Y, +Z, -Z
+func NewCubemapFromFiles(paths []string) (*Cubemap, error) {
+	var faces [6][]float32
+	size := 0
+	for i, path := range paths {
+		width, height, rgb, err := loadRadiance(path)
+		if err != nil {
+			return nil, err
+		}
+		if width != height || (size != 0 && width != size) {
+			return nil, fmt.Errorf("%s: cubemap face is %dx%d, expected square faces of equal size", path, width, height)
+		}
+		size = width
+		faces[i] = rgb
+	}
+	return NewCubemap(size, faces), nil
+}
+
+// crossCells - клетки граней в горизонтальном (4x3) кресте
+var crossCells = [6][2]int{
+	FacePosX: {2, 1},
+	FaceNegX: {0, 1},
+	FacePosY: {1, 0},
+	FaceNegY: {1, 2},
+	FacePosZ: {1, 1},
+	FaceNegZ: {3, 1},
+}
+
+// NewCubemapFromCross вырезает грани из развёртки крестом. В вертикальном (3x4) кресте
+// грань -Z лежит внизу и повёрнута на 180°.
+func NewCubemapFromCross(width, height int, rgb []float32) (*Cubemap, error) {
+	vertical := 4*width == 3*height
+	if !vertical && 3*width != 4*height {
+		return nil, fmt.Errorf("cubemap cross must be 4:3 or 3:4, got %dx%d", width, height)
+	}
+
+	size := width / 4
+	if vertical {
+		size = width / 3
+	}
+
+	var faces [6][]float32
+	for face := range faces {
+		cell := crossCells[face]
+		rotated := false
+		if vertical && face == FaceNegZ {
+			cell = [2]int{1, 3}
+			rotated = true
+		}
+
+		pixels := make([]float32, 0, 3*size*size)
+		for y := 0; y < size; y++ {
+			for x := 0; x < size; x++ {
+				sx, sy := x, y
+				if rotated {
+					sx, sy = size-1-x, size-1-y
+				}
+				i := 3 * ((cell[1]*size+sy)*width + cell[0]*size + sx)
+				pixels = append(pixels, rgb[i:i+3]...)
+			}
+		}
+		faces[face] = pixels
+	}
+	return NewCubemap(size, faces), nil
+}
+
+// NewCubemapFromEnvironment переводит окружение в куб с гранями size x size.
+// Поворот и яркость исходного окружения запекаются в пиксели.
+func NewCubemapFromEnvironment(env Environment, size int) *Cubemap {
+	var faces [6][]float32
+	for face := range faces {
+		pixels := make([]float32, 0, 3*size*size)
+		for y := 0; y < size; y++ {
+			for x := 0; x < size; x++ {
+				sc := (float64(x)+0.5)/float64(size)*2 - 1
+				tc := (float64(y)+0.5)/float64(size)*2 - 1
+				c := env.GetImageCoords(faceDirection(face, sc, tc).Normalize())
+				pixels = append(pixels, float32(c.X), float32(c.Y), float32(c.Z))
+			}
+		}
+		faces[face] = pixels
+	}
+	return NewCubemap(size, faces)
+}
+
+// Cross возвращает грани, разложенные горизонтальным крестом; пустые клетки чёрные
+func (c *Cubemap) Cross() (width, height int, rgb []float32) {
+	width, height = 4*c.size, 3*c.size
+	rgb = make([]float32, 3*width*height)
+	for face, cell := range crossCells {
+		for y := 0; y < c.size; y++ {
+			dst := 3 * ((cell[1]*c.size+y)*width + cell[0]*c.size)
+			copy(rgb[dst:dst+3*c.size], c.faces[face][3*y*c.size:3*(y+1)*c.size])
+		}
+	}
+	return width, height, rgb
+}
+
+// cubeFace выбирает грань по наибольшей компоненте направления и возвращает
+// координаты на ней в [-1, 1]: sc растёт вправо, tc - вниз по изображению грани
+func cubeFace(direction Vector) (face int, sc, tc float64) {
+	// Мировые координаты: +Y вниз, камера смотрит в -Z
+	x, y, z := direction.X, -direction.Y, -direction.Z
+	ax, ay, az := math.Abs(x), math.Abs(y), math.Abs(z)
+
+	switch {
+	case ax >= ay && ax >= az:
+		if x > 0 {
+			return FacePosX, -z / ax, -y / ax
+		}
+		return FaceNegX, z / ax, -y / ax
+	case ay >= az:
+		if y > 0 {
+			return FacePosY, x / ay, z / ay
+		}
+		return FaceNegY, x / ay, -z / ay
+	default:
+		if z > 0 {
+			return FacePosZ, x / az, -y / az
+		}
+		return FaceNegZ, -x / az, -y / az
+	}
+}
+
+// faceDirection - обратное к cubeFace преобразование (вектор не нормирован)
+func faceDirection(face int, sc, tc float64) Vector {
+	var x, y, z float64
+	switch face {
+	case FacePosX:
+		x, y, z = 1, -tc, -sc
+	case FaceNegX:
+		x, y, z = -1, -tc, sc
+	case FacePosY:
+		x, y, z = sc, 1, tc
+	case FaceNegY:
+		x, y, z = sc, -1, -tc
+	case FacePosZ:
+		x, y, z = sc, -tc, 1
+	default:
+		x, y, z = -sc, -tc, -1
+	}
+	return Vector{x, -y, -z}
+}
+
+// texel возвращает пиксель грани. Пиксели за краем берутся с соседней грани,
+// поэтому билинейная фильтрация не даёт швов.
+func (c *Cubemap) texel(face, x, y int) Vector {
+	if x < 0 || x >= c.size || y < 0 || y >= c.size {
+		sc := (float64(x)+0.5)/float64(c.size)*2 - 1
+		tc := (float64(y)+0.5)/float64(c.size)*2 - 1
+		var nsc, ntc float64
+		face, nsc, ntc = cubeFace(faceDirection(face, sc, tc))
+		x = clamp(int((nsc+1)/2*float64(c.size)), 0, c.size-1)
+		y = clamp(int((ntc+1)/2*float64(c.size)), 0, c.size-1)
+	}
+
+	i := 3 * (y*c.size + x)
+	pixels := c.faces[face]
+	return Vector{float64(pixels[i]), float64(pixels[i+1]), float64(pixels[i+2])}
+}
+
+// GetImageCoords возвращает яркость окружения в направлении normal с билинейной фильтрацией
+func (c *Cubemap) GetImageCoords(normal Vector) Vector {
+	face, sc, tc := cubeFace(rotateY(normal, -c.Rotation*math.Pi/180))
+
+	fx := (sc+1)/2*float64(c.size) - 0.5
+	fy := (tc+1)/2*float64(c.size) - 0.5
+	x0 := int(math.Floor(fx))
+	y0 := int(math.Floor(fy))
+	tx := fx - float64(x0)
+	ty := fy - float64(y0)
+
+	top := c.texel(face, x0, y0).Mul(1 - tx).Add(c.texel(face, x0+1, y0).Mul(tx))
+	bottom := c.texel(face, x0, y0+1).Mul(1 - tx).Add(c.texel(face, x0+1, y0+1).Mul(tx))
+	return top.Mul(1 - ty).Add(bottom.Mul(ty)).Mul(c.Intensity)
+}
+
+// Sample выбирает направление пропорционально яркости по вспомогательной панораме
+func (c *Cubemap) Sample(u1, u2 float64) (Vector, Vector, float64) {
+	direction, _, pdf := c.distribution.Sample(u1, u2)
+	direction = rotateY(direction, c.Rotation*math.Pi/180)
+	return direction, c.GetImageCoords(direction), pdf
+}
+
+// Pdf возвращает плотность вероятности выбора направления методом Sample
+func (c *Cubemap) Pdf(direction Vector) float64 {
+	return c.distribution.Pdf(rotateY(direction, -c.Rotation*math.Pi/180))
+}
@@ -0,0 +1,90 @@
+package tracer
+
+import "testing"
+
+// testCubemap - куб со случайными пикселями, на котором заметен любой шов
+func testCubemap(size int) *Cubemap {
+	var faces [6][]float32
+	for face := range faces {
+		for i := 0; i < 3*size*size; i++ {
+			faces[face] = append(faces[face], float32(hashUint32(uint32(face), uint32(i))%1000)/1000)
+		}
+	}
+	return NewCubemap(size, faces)
+}
+
+// Выбор грани обратим, а камера по умолчанию смотрит на грань +Z без зеркального отражения
+func TestCubeFace(t *testing.T) {
+	sampler := NewIndependentSampler(3)
+	for i := 0; i < 1000; i++ {
+		sampler.StartSample(i, 0, 0)
+		u, v := sampler.Get2D()
+		direction := equirectDirection(u, v)
+
+		face, sc, tc := cubeFace(direction)
+		back := faceDirection(face, sc, tc).Normalize()
+		if back.Sub(direction).Magnitude() > 1e-6 {
+			t.Fatalf("direction %v maps to face %d (%g, %g) and back to %v", direction, face, sc, tc, back)
+		}
+	}
+
+	face, sc, tc := cubeFace(Vector{0.1, -0.1, -1})
+	if face != FacePosZ || sc <= 0 || tc >= 0 {
+		t.Errorf("forward, right and up maps to face %d (%g, %g), want face %d with sc > 0, tc < 0", face, sc, tc, FacePosZ)
+	}
+}
+
+// По обе стороны ребра куба яркость почти одинакова
+func TestCubemapSeams(t *testing.T) {
+	const eps = 1e-7
+	cubemap := testCubemap(8)
+
+	for face := 0; face < 6; face++ {
+		for _, along := range []float64{-0.8, -0.3, 0.1, 0.6} {
+			for _, edge := range [][2]float64{{1, along}, {-1, along}, {along, 1}, {along, -1}} {
+				inside := faceDirection(face, edge[0]*(1-eps), edge[1]*(1-eps)).Normalize()
+				outside := faceDirection(face, edge[0]*(1+eps), edge[1]*(1+eps)).Normalize()
+				a := cubemap.GetImageCoords(inside)
+				b := cubemap.GetImageCoords(outside)
+				if d := a.Sub(b).Magnitude(); d > 1e-3 {
+					t.Errorf("face %d edge %v: %v vs %v across the seam", face, edge, a, b)
+				}
+			}
+		}
+	}
+}
+
+// Перевод панорамы в куб и обратно сохраняет плавное окружение
+func TestCubemapConversion(t *testing.T) {
+	const width, height = 128, 64
+	rgb := make([]float32, 0, 3*width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			d := equirectDirection((float64(x)+0.5)/width, (float64(y)+0.5)/height)
+			rgb = append(rgb, float32(1+0.8*d.X), float32(1-0.5*d.Y), float32(1+0.6*d.X*d.Z))
+		}
+	}
+	smooth := NewSkyboxFromRadiance(width, height, rgb)
+
+	cubemap := NewCubemapFromEnvironment(smooth, 32)
+	back := NewSkyboxFromEnvironment(cubemap, width, height)
+
+	crossWidth, crossHeight, cross := cubemap.Cross()
+	crossed, err := NewCubemapFromCross(crossWidth, crossHeight, cross)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sampler := NewIndependentSampler(5)
+	for i := 0; i < 500; i++ {
+		sampler.StartSample(i, 0, 0)
+		direction := equirectDirection(sampler.Get2D())
+
+		want := smooth.GetImageCoords(direction)
+		for name, env := range map[string]Environment{"cubemap": cubemap, "equirect": back, "cross": crossed} {
+			if got := env.GetImageCoords(direction); got.Sub(want).Magnitude() > 0.02 {
+				t.Fatalf("%s: direction %v: got %v, want %v", name, direction, got, want)
+			}
+		}
+	}
+}
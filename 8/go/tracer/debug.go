@@ -0,0 +1,176 @@
+package tracer
+
+import (
+	"fmt"
+	"math"
+)
+
+// DebugMode - отладочное отображение первого пересечения вместо освещения.
+// Показывает геометрию как её видит трассировщик: нормали, выбор граней, стоимость пересечений.
+type DebugMode int
+
+const (
+	DebugOff       DebugMode = iota // Обычное освещение
+	DebugNormal                     // Нормаль как цвет: 0.5 + 0.5n
+	DebugUV                         // Шахматка по текстурным координатам поверхности
+	DebugDepth                      // Расстояние от камеры оттенками серого, ближе - светлее
+	DebugObjectID                   // Постоянный случайный цвет на объект
+	DebugCost                       // Шаги поиска пересечения луча из камеры по всем объектам, от синего до красного
+	DebugFacing                     // Косинус между нормалью и направлением на камеру, обратные нормали красные
+	DebugOcclusion                  // Только окклюзия фонового света, без остального освещения
+)
+
+var debugModeNames = map[DebugMode]string{
+	DebugOff:       "off",
+	DebugNormal:    "normal",
+	DebugUV:        "uv",
+	DebugDepth:     "depth",
+	DebugObjectID:  "objectid",
+	DebugCost:      "cost",
+	DebugFacing:    "facing",
+	DebugOcclusion: "ao",
+}
+
+// DebugModes - режимы в порядке переключения, номер режима совпадает с клавишей в окне
+var DebugModes = []DebugMode{DebugOff, DebugNormal, DebugUV, DebugDepth, DebugObjectID, DebugCost, DebugFacing, DebugOcclusion}
+
+// Шкала режима cost: логарифмическая от одного шага до 10^debugCostDecades шагов
+const (
+	debugCostDecades = 5
+
+	debugCheckers = 8 // Клеток шахматки на единицу текстурной координаты
+)
+
+func (m DebugMode) String() string {
+	if name, ok := debugModeNames[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("DebugMode(%d)", int(m))
+}
+
+// ParseDebugMode разбирает название отладочного режима
+func ParseDebugMode(name string) (DebugMode, error) {
+	for _, m := range DebugModes {
+		if m.String() == name {
+			return m, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown debug mode %q (expected off, normal, uv, depth, objectid, cost, facing or ao)", name)
+}
+
+// debugSample трассирует луч из камеры в отладочном режиме r.Debug.
+// Цвет задан для дисплея и переводится в линейную яркость, так что с компрессией clamp
+// без экспозиции на экран попадает как есть. Признаки заполняются, как при обычном рендере.
+func (r *Renderer) debugSample(sampler Sampler, counters *rayCounters, ray Ray) (Vector, Features) {
+	hit, obj, found := ray.cast(r.Scene.Objects, counters)
+
+	var c Vector
+	features := skyFeatures
+	if found {
+		normal := obj.GetNormal(hit.Point)
+		features = Features{
+			Albedo: obj.GetMaterial(hit.Point).DiffuseColor,
+			Normal: normal,
+			Depth:  hit.Distance,
+			Object: r.Scene.ObjectID(obj),
+			AO:     1,
+		}
+
+		switch r.Debug {
+		case DebugNormal:
+			c = normal.Mul(0.5).Add(0.5)
+		case DebugUV:
+			u, v := surfaceUV(obj, hit.Point)
+			c = Vector{u - math.Floor(u), v - math.Floor(v), 0.5}
+			if (int(math.Floor(u*debugCheckers))+int(math.Floor(v*debugCheckers)))%2 != 0 {
+				c = c.Mul(0.35)
+			}
+		case DebugDepth:
+			scale := r.DebugDepth
+			if scale <= 0 {
+				scale = r.Scene.Camera.FocusDistance
+			}
+			gray := 1 - hit.Distance/(hit.Distance+scale)
+			c = Vector{gray, gray, gray}
+		case DebugObjectID:
+			c = objectColor(features.Object)
+		case DebugFacing:
+			facing := -normal.Dot(ray.Direction)
+			if facing >= 0 {
+				c = Vector{facing, facing, facing}
+			} else {
+				c = Vector{-facing, 0, 0}
+			}
+		case DebugOcclusion:
+			settings, _ := r.occlusionSettings()
+			if normal.Dot(ray.Direction) > 0 {
+				normal = normal.Neg()
+			}
+			features.AO = r.occlusion(sampler, counters, settings, hit.Point, normal)
+			c = Vector{features.AO, features.AO, features.AO}
+		}
+	}
+	if r.Debug == DebugCost {
+		// Промахи тоже проверяют все объекты, поэтому окружение не чёрное
+		c = heatColor(math.Log10(float64(intersectionCost(r.Scene.Objects, ray))) / debugCostDecades)
+	}
+
+	return Vector{srgbToLinear(saturate(c.X)), srgbToLinear(saturate(c.Y)), srgbToLinear(saturate(c.Z))}, features
+}
+
+// intersectionStepper - объект с итеративным поиском пересечения, который умеет сказать,
+// сколько шагов понадобилось лучу
+type intersectionStepper interface {
+	intersectionSteps(ray Ray) int
+}
+
+// intersectionCost возвращает число шагов поиска пересечения луча со всеми объектами.
+// Аналитическая проверка считается за один шаг. Результат не зависит от машины и загрузки,
+// так что режим DebugCost одинаков при каждом запуске.
+func intersectionCost(objects []SceneObject, ray Ray) int {
+	cost := 0
+	for _, obj := range objects {
+		if s, ok := obj.(intersectionStepper); ok {
+			cost += s.intersectionSteps(ray)
+		} else {
+			cost++
+		}
+	}
+	return cost
+}
+
+// surfaceUV возвращает текстурные координаты точки на поверхности объекта:
+// сфера и тор - по углам, куб - по грани, которую выбрал GetNormal, тетраэдр - барицентрические
+// в выбранной грани, доска - мировые X и Z. Для остальных объектов - мировые X и Y.
+func surfaceUV(obj SceneObject, p Vector) (float64, float64) {
+	switch o := obj.(type) {
+	case *Sphere:
+		d := p.Sub(o.Center).Div(o.Radius)
+		return 0.5 + math.Atan2(d.Z, d.X)/(2*math.Pi), math.Acos(math.Max(-1, math.Min(1, d.Y))) / math.Pi
+	case *Cube:
+		local := p.Sub(o.Center).Div(o.Size).Add(0.5)
+		switch n := o.GetNormal(p); {
+		case n.X != 0:
+			return local.Z, local.Y
+		case n.Y != 0:
+			return local.X, local.Z
+		default:
+			return local.X, local.Y
+		}
+	case *Torus:
+		ring := math.Hypot(p.X, p.Z)
+		return 0.5 + math.Atan2(p.Z, p.X)/(2*math.Pi), 0.5 + math.Atan2(p.Y, ring-o.MajorRadius)/(2*math.Pi)
+	case *Tetrahedron:
+		i := o.closestFace(p)
+		if i < 0 {
+			return 0, 0
+		}
+		face := o.Faces[i]
+		_, v, w := barycentric(p, o.Vertices[face[0]], o.Vertices[face[1]], o.Vertices[face[2]])
+		return v, w
+	case *InfinityChessBoard:
+		return p.X / debugCheckers, p.Z / debugCheckers
+	default:
+		return p.X, p.Y
+	}
+}
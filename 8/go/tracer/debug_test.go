@@ -0,0 +1,101 @@
+package tracer
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"testing"
+)
+
+func TestParseDebugMode(t *testing.T) {
+	for _, m := range DebugModes {
+		got, err := ParseDebugMode(m.String())
+		if err != nil || got != m {
+			t.Errorf("ParseDebugMode(%q) = %v, %v", m, got, err)
+		}
+	}
+	if _, err := ParseDebugMode("bvh"); err == nil {
+		t.Error("unknown mode accepted")
+	}
+}
+
+// Отладочные режимы показывают нормаль и цвет объекта под пикселем так же, как их видит Pick
+func TestDebugModes(t *testing.T) {
+	const width, height = 48, 24
+	scene := testScene(width, height)
+	scene.Camera.Aperture = 0
+	x, y := width/2, height/2-2 // Сфера, см. TestFocusAt
+	pick, ok := scene.Pick(Vector{float64(x), float64(y), 0})
+	if !ok {
+		t.Fatal("ray missed the sphere")
+	}
+
+	render := func(mode DebugMode) Vector {
+		r := NewRenderer(scene, width, height)
+		r.SamplesPerPixel = 1
+		r.Sampler = NewIndependentSampler(1)
+		r.Debug = mode
+		frame, err := r.Render(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := frame.Image.RGBAAt(x, y)
+		return Vector{float64(c.R), float64(c.G), float64(c.B)}.Div(255)
+	}
+
+	// Сэмпл смещён внутри пикселя, поэтому нормаль совпадает с точностью до кривизны сферы
+	near := func(got, want Vector) bool {
+		return math.Abs(got.X-want.X) < 0.05 && math.Abs(got.Y-want.Y) < 0.05 && math.Abs(got.Z-want.Z) < 0.05
+	}
+	if got, want := render(DebugNormal), pick.Normal.Mul(0.5).Add(0.5); !near(got, want) {
+		t.Errorf("normal mode %v, want %v", got, want)
+	}
+	if got, want := render(DebugObjectID), objectColor(pick.ID); !near(got, want) {
+		t.Errorf("objectid mode %v, want %v", got, want)
+	}
+	if got := render(DebugFacing); got.X != got.Y || got.X < 0.5 {
+		t.Errorf("sphere facing the camera rendered as %v", got)
+	}
+}
+
+// Барицентрические координаты выбранной грани тетраэдра лежат в треугольнике
+func TestSurfaceUVTetrahedron(t *testing.T) {
+	tetra := NewTetrahedron(Vector{0, 0, 0}, Vector{1, 0, 0}, Vector{0, 1, 0}, Vector{0, 0, 1}, Material{})
+	u, v := surfaceUV(tetra, Vector{0.25, 0.25, 0})
+	if u != 0.25 || v != 0.25 {
+		t.Errorf("uv %v, %v, want 0.25, 0.25", u, v)
+	}
+}
+
+// Стоимость считается в шагах: промах мимо тора дороже попадания, а изображение
+// режима cost не зависит от числа рабочих
+func TestDebugCost(t *testing.T) {
+	torus := NewTorus(2, 0.5, Material{})
+	objects := []SceneObject{torus, NewSphere(Vector{0, 0, -20}, 1, Material{})}
+	hit := intersectionCost(objects, NewRay(Vector{2, 5, 0}, Vector{0, -1, 0}))
+	miss := intersectionCost(objects, NewRay(Vector{0, 5, 0}, Vector{0, -1, 0}))
+	if hit <= 1 || hit >= miss || miss != 10000+1 {
+		t.Errorf("cost of a torus hit %d and miss %d, want fewer steps to the hit and 10001 for the miss", hit, miss)
+	}
+
+	const width, height = 48, 24
+	scene := testScene(width, height)
+	scene.Objects = append(scene.Objects, NewTorus(2, 0.5, Material{}))
+	var reference []byte
+	for _, workers := range []int{1, 3} {
+		r := NewRenderer(scene, width, height)
+		r.SamplesPerPixel = 1
+		r.Sampler = NewIndependentSampler(1)
+		r.Scheduler = Scheduler{TileSize: 8, Order: TileOrderScanline, Workers: workers}
+		r.Debug = DebugCost
+		frame, err := r.Render(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reference == nil {
+			reference = frame.Image.Pix
+		} else if !bytes.Equal(reference, frame.Image.Pix) {
+			t.Errorf("cost image with %d workers differs from 1 worker", workers)
+		}
+	}
+}
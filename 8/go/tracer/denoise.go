@@ -0,0 +1,197 @@
+package tracer
+
+import (
+	"math"
+	"runtime"
+	"sync"
+)
+
+const (
+	DefaultDenoiseStrength = 2 // Сила шумоподавления, подобранная для нескольких сэмплов на пиксель
+
+	albedoEpsilon = 0.01 // Не даёт делить на чёрный диффузный цвет при демодуляции
+)
+
+// Denoiser - фильтр à-trous (Dammertz и др., 2010), сохраняющий края по признакам кадра.
+// Как в SVGF (Schied и др., 2017), допуск по яркости соседей зависит от дисперсии пикселя:
+// сошедшиеся области почти не размываются. Фильтруется освещённость - яркость,
+// делённая на диффузный цвет, поэтому текстуры не размываются.
+type Denoiser struct {
+	Iterations  int     // Проходов фильтра, радиус растёт до 2^Iterations пикселей
+	Strength    float64 // Допуск по яркости в стандартных отклонениях шума, 0 - без фильтрации
+	NormalPower float64 // Степень косинуса угла между нормалями соседей
+	DepthSigma  float64 // Допустимая относительная разница глубины
+	AlbedoSigma float64 // Допустимая разница диффузного цвета
+}
+
+// NewDenoiser создаёт денойзер с силой strength и настройками по умолчанию
+func NewDenoiser(strength float64) Denoiser {
+	return Denoiser{
+		Iterations:  5,
+		Strength:    strength,
+		NormalPower: 64,
+		DepthSigma:  0.05,
+		AlbedoSigma: 0.1,
+	}
+}
+
+// atrousKernel - ядро B3-сплайна
+var atrousKernel = [5]float64{1.0 / 16, 1.0 / 4, 3.0 / 8, 1.0 / 4, 1.0 / 16}
+
+// denoiseLayer - освещённость и дисперсия её яркости на одном проходе фильтра
+type denoiseLayer struct {
+	irradiance []float32
+	variance   []float32
+}
+
+// Denoise возвращает копию кадра с отфильтрованной яркостью, заново прошедшей тональную компрессию
+func (d Denoiser) Denoise(src *Frame, tm ToneMapper) *Frame {
+	dst := src.Clone()
+	if d.Strength <= 0 || d.Iterations <= 0 {
+		return dst
+	}
+
+	width, height := src.Width, src.Height
+	demodulation := func(i int) Vector {
+		return Vector{float64(src.Albedo[3*i]), float64(src.Albedo[3*i+1]), float64(src.Albedo[3*i+2])}.Add(albedoEpsilon)
+	}
+
+	current := denoiseLayer{make([]float32, len(src.Radiance)), make([]float32, width*height)}
+	next := denoiseLayer{make([]float32, len(src.Radiance)), make([]float32, width*height)}
+	for i := 0; i < width*height; i++ {
+		albedo := demodulation(i)
+		current.irradiance[3*i] = src.Radiance[3*i] / float32(albedo.X)
+		current.irradiance[3*i+1] = src.Radiance[3*i+1] / float32(albedo.Y)
+		current.irradiance[3*i+2] = src.Radiance[3*i+2] / float32(albedo.Z)
+		current.variance[i] = src.Variance[i] / float32(albedo.Luminance()*albedo.Luminance())
+	}
+	estimateMissingVariance(src, current)
+
+	for iteration := 0; iteration < d.Iterations; iteration++ {
+		step := 1 << iteration
+		parallelRows(height, func(y int) {
+			for x := 0; x < width; x++ {
+				d.filterPixel(src, current, next, x, y, step)
+			}
+		})
+		current, next = next, current
+	}
+
+	for i := 0; i < width*height; i++ {
+		albedo := demodulation(i)
+		dst.Radiance[3*i] = current.irradiance[3*i] * float32(albedo.X)
+		dst.Radiance[3*i+1] = current.irradiance[3*i+1] * float32(albedo.Y)
+		dst.Radiance[3*i+2] = current.irradiance[3*i+2] * float32(albedo.Z)
+		dst.Variance[i] = current.variance[i] * float32(albedo.Luminance()*albedo.Luminance())
+	}
+	dst.ToneMap(tm)
+	return dst
+}
+
+// estimateMissingVariance оценивает дисперсию пикселей с одним сэмплом по соседям 3x3
+func estimateMissingVariance(f *Frame, layer denoiseLayer) {
+	for y := 0; y < f.Height; y++ {
+		for x := 0; x < f.Width; x++ {
+			p := y*f.Width + x
+			if layer.variance[p] >= 0 {
+				continue
+			}
+
+			var sum, sumSquares, n float64
+			for qy := max(0, y-1); qy <= min(f.Height-1, y+1); qy++ {
+				for qx := max(0, x-1); qx <= min(f.Width-1, x+1); qx++ {
+					l := layer.luminance(qy*f.Width + qx)
+					sum += l
+					sumSquares += l * l
+					n++
+				}
+			}
+			mean := sum / n
+			layer.variance[p] = float32(math.Max(0, sumSquares/n-mean*mean))
+		}
+	}
+}
+
+func (l denoiseLayer) color(i int) Vector {
+	return Vector{float64(l.irradiance[3*i]), float64(l.irradiance[3*i+1]), float64(l.irradiance[3*i+2])}
+}
+
+func (l denoiseLayer) luminance(i int) float64 {
+	return l.color(i).Luminance()
+}
+
+// filterPixel записывает в dst взвешенное среднее 5x5 соседей пикселя (x, y) с шагом step
+// и дисперсию этого среднего
+func (d Denoiser) filterPixel(f *Frame, src, dst denoiseLayer, x, y, step int) {
+	p := y*f.Width + x
+	normalP := Vector{float64(f.Normal[3*p]), float64(f.Normal[3*p+1]), float64(f.Normal[3*p+2])}
+	albedoP := Vector{float64(f.Albedo[3*p]), float64(f.Albedo[3*p+1]), float64(f.Albedo[3*p+2])}
+	depthP := float64(f.Depth[p])
+	lumP := src.luminance(p)
+	sigmaP := d.Strength*math.Sqrt(float64(src.variance[p])) + 1e-4
+
+	sum := Vector{0, 0, 0}
+	weights, variance := 0.0, 0.0
+	for ky := -2; ky <= 2; ky++ {
+		qy := y + ky*step
+		if qy < 0 || qy >= f.Height {
+			continue
+		}
+		for kx := -2; kx <= 2; kx++ {
+			qx := x + kx*step
+			if qx < 0 || qx >= f.Width {
+				continue
+			}
+
+			q := qy*f.Width + qx
+			depthQ := float64(f.Depth[q])
+
+			// Окружение смешивается только с окружением
+			if (depthP == 0) != (depthQ == 0) {
+				continue
+			}
+
+			// Признаки центрального пикселя с ним самим не сравниваются: у нулевой усреднённой
+			// нормали (противоположные нормали на силуэте) косинус с самой собой равен 0
+			weight := atrousKernel[kx+2] * atrousKernel[ky+2]
+			weight *= math.Exp(-math.Abs(src.luminance(q)-lumP) / sigmaP)
+			if depthP > 0 && q != p {
+				normalQ := Vector{float64(f.Normal[3*q]), float64(f.Normal[3*q+1]), float64(f.Normal[3*q+2])}
+				albedoQ := Vector{float64(f.Albedo[3*q]), float64(f.Albedo[3*q+1]), float64(f.Albedo[3*q+2])}
+
+				cosine := normalP.Dot(normalQ) / (normalP.Magnitude()*normalQ.Magnitude() + 1e-9)
+				weight *= math.Pow(math.Max(0, cosine), d.NormalPower)
+				weight *= math.Exp(-math.Abs(depthP-depthQ) / (d.DepthSigma * depthP * float64(step)))
+				albedoDifference := albedoQ.Sub(albedoP).Magnitude() / d.AlbedoSigma
+				weight *= math.Exp(-albedoDifference * albedoDifference)
+			}
+
+			sum = sum.Add(src.color(q).Mul(weight))
+			weights += weight
+			variance += weight * weight * float64(src.variance[q])
+		}
+	}
+
+	// Вес центрального пикселя не зависит от признаков, поэтому сумма весов положительна
+	result := sum.Mul(1 / weights)
+	dst.irradiance[3*p] = float32(result.X)
+	dst.irradiance[3*p+1] = float32(result.Y)
+	dst.irradiance[3*p+2] = float32(result.Z)
+	dst.variance[p] = float32(variance / (weights * weights))
+}
+
+// parallelRows вызывает row для каждой строки на всех ядрах
+func parallelRows(height int, row func(y int)) {
+	workers := min(runtime.NumCPU(), height)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for y := w; y < height; y += workers {
+				row(y)
+			}
+		}(w)
+	}
+	wg.Wait()
+}
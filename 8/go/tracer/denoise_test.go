@@ -0,0 +1,79 @@
+package tracer
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+// Денойзер приближает малосэмпловый рендер к сошедшемуся
+func TestDenoiseReducesError(t *testing.T) {
+	const width, height = 96, 48
+
+	render := func(samples int) *Frame {
+		sampler, err := NewSampler("sobol", samples, 11)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Освещение небом с одним направлением на точку даёт заметный шум
+		sky := NewProceduralSky(30, 60, DefaultTurbidity)
+		scene := testScene(width, height)
+		scene.Skybox = sky
+		scene.Light = sky.SunLight()
+
+		r := NewRenderer(scene, width, height)
+		r.SamplesPerPixel = samples
+		r.EnvironmentSamples = 1
+		r.Sampler = sampler
+		r.Scheduler.Workers = 1
+		frame, err := r.Render(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return frame
+	}
+
+	reference := render(64)
+	noisy := render(2)
+	denoised := NewDenoiser(2).Denoise(noisy, NewToneMapper())
+
+	rmse := func(f *Frame) float64 {
+		sum := 0.0
+		for i, v := range f.Radiance {
+			d := float64(v - reference.Radiance[i])
+			sum += d * d
+		}
+		return math.Sqrt(sum / float64(len(f.Radiance)))
+	}
+
+	before, after := rmse(noisy), rmse(denoised)
+	t.Logf("RMSE: noisy %.4f, denoised %.4f", before, after)
+	if after >= 0.9*before {
+		t.Errorf("denoised RMSE %.4f is not clearly below noisy RMSE %.4f", after, before)
+	}
+
+	// Нулевая сила оставляет кадр без изменений
+	if unchanged := NewDenoiser(0).Denoise(noisy, NewToneMapper()); rmse(unchanged) != before {
+		t.Errorf("zero strength changed the frame")
+	}
+}
+
+// Пиксель с нулевой усреднённой нормалью, которого отвергают все соседи, остаётся конечным
+func TestDenoiseZeroNormal(t *testing.T) {
+	const width, height = 5, 5
+	frame := NewFrame(width, height)
+	for i := 0; i < width*height; i++ {
+		frame.Set(i%width, i/width, Vector{0.5, 0.5, 0.5}, NewToneMapper())
+		frame.SetFeatures(i%width, i/width, Features{Albedo: Vector{1, 1, 1}, Normal: Vector{0, 1, 0}, Depth: 1}, 0.1)
+	}
+	// Противоположные нормали силуэта усреднились в ноль
+	center := width * height / 2
+	frame.SetFeatures(center%width, center/width, Features{Albedo: Vector{1, 1, 1}, Depth: 1}, 0.1)
+
+	denoised := NewDenoiser(2).Denoise(frame, NewToneMapper())
+	for i, v := range denoised.Radiance {
+		if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+			t.Fatalf("radiance value %d is %v", i, v)
+		}
+	}
+}
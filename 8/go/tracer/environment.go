@@ -0,0 +1,150 @@
+package tracer
+
+import (
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Environment - окружение сцены: яркость для лучей без пересечений
+// и выбор направлений для освещения окружением
+type Environment interface {
+	// GetImageCoords возвращает линейную яркость окружения в направлении direction
+	GetImageCoords(direction Vector) Vector
+	// Sample выбирает направление пропорционально яркости.
+	// Возвращает направление, яркость в нём и плотность вероятности по телесному углу.
+	Sample(u1, u2 float64) (Vector, Vector, float64)
+	// Pdf возвращает плотность вероятности выбора направления методом Sample
+	Pdf(direction Vector) float64
+}
+
+// EnvironmentLayout - раскладка изображения окружения
+type EnvironmentLayout int
+
+const (
+	LayoutAuto     EnvironmentLayout = iota // По пропорциям: 4:3 и 3:4 - крест, остальное - панорама
+	LayoutEquirect                          // Равнопромежуточная панорама 2:1
+	LayoutCross                             // Развёртка куба крестом, горизонтальным или вертикальным
+)
+
+var environmentLayoutNames = map[EnvironmentLayout]string{
+	LayoutAuto:     "auto",
+	LayoutEquirect: "equirect",
+	LayoutCross:    "cross",
+}
+
+func (l EnvironmentLayout) String() string {
+	if name, ok := environmentLayoutNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("EnvironmentLayout(%d)", int(l))
+}
+
+// ParseEnvironmentLayout разбирает название раскладки окружения
+func ParseEnvironmentLayout(name string) (EnvironmentLayout, error) {
+	for l, n := range environmentLayoutNames {
+		if n == name {
+			return l, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown environment layout %q (expected auto, equirect or cross)", name)
+}
+
+// EnvironmentOptions задаёт загрузку окружения
+type EnvironmentOptions struct {
+	Layout    EnvironmentLayout
+	Rotation  float64 // Поворот вокруг вертикальной оси в градусах
+	Intensity float64 // Множитель яркости
+}
+
+// LoadEnvironment загружает окружение. path - одно изображение (панорама или крест)
+// либо шесть файлов граней через запятую в порядке +X, -X, +Y, -Y, +Z, -Z.
+func LoadEnvironment(path string, options EnvironmentOptions) (Environment, error) {
+	if paths := strings.Split(path, ","); len(paths) > 1 {
+		if len(paths) != 6 {
+			return nil, fmt.Errorf("expected 6 cubemap faces, got %d", len(paths))
+		}
+		cubemap, err := NewCubemapFromFiles(paths)
+		if err != nil {
+			return nil, err
+		}
+		cubemap.Rotation = options.Rotation
+		cubemap.Intensity = options.Intensity
+		return cubemap, nil
+	}
+
+	width, height, rgb, err := loadRadiance(path)
+	if err != nil {
+		return nil, err
+	}
+
+	layout := options.Layout
+	if layout == LayoutAuto {
+		layout = LayoutEquirect
+		if 3*width == 4*height || 4*width == 3*height {
+			layout = LayoutCross
+		}
+	}
+
+	if layout == LayoutCross {
+		cubemap, err := NewCubemapFromCross(width, height, rgb)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		cubemap.Rotation = options.Rotation
+		cubemap.Intensity = options.Intensity
+		return cubemap, nil
+	}
+
+	skybox := NewSkyboxFromRadiance(width, height, rgb)
+	skybox.path = path
+	skybox.Rotation = options.Rotation
+	skybox.Intensity = options.Intensity
+	return skybox, nil
+}
+
+// loadRadiance читает изображение в линейные значения: .hdr как есть, остальные форматы из sRGB
+func loadRadiance(path string) (width, height int, rgb []float32, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("failed to open environment image: %w", err)
+	}
+	defer file.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".hdr") {
+		width, height, rgb, err = ReadHDR(file)
+		if err != nil {
+			return 0, 0, nil, fmt.Errorf("failed to decode environment image: %w", err)
+		}
+		return width, height, rgb, nil
+	}
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("failed to decode environment image: %w", err)
+	}
+	width, height, rgb = imageRadiance(img)
+	return width, height, rgb, nil
+}
+
+// imageRadiance переводит 8-битное sRGB изображение в линейные значения
+func imageRadiance(img image.Image) (width, height int, rgb []float32) {
+	bounds := img.Bounds()
+	width, height = bounds.Dx(), bounds.Dy()
+
+	rgb = make([]float32, 0, 3*width*height)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			rgb = append(rgb,
+				float32(srgbToLinear(float64(r)/65535.0)),
+				float32(srgbToLinear(float64(g)/65535.0)),
+				float32(srgbToLinear(float64(b)/65535.0)))
+		}
+	}
+	return width, height, rgb
+}
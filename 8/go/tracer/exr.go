@@ -0,0 +1,283 @@
+package tracer
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// EXRPixelType - тип значений каналов OpenEXR
+type EXRPixelType int
+
+const (
+	EXRHalf  EXRPixelType = 1 // 16-битное число с плавающей точкой
+	EXRFloat EXRPixelType = 2 // 32-битное число с плавающей точкой
+)
+
+// EXRCompression - сжатие блоков строк OpenEXR
+type EXRCompression int
+
+const (
+	EXRNoCompression  EXRCompression = 0
+	EXRZipCompression EXRCompression = 3 // zlib по блокам из 16 строк
+)
+
+// EXROptions задаёт формат записи OpenEXR
+type EXROptions struct {
+	PixelType   EXRPixelType
+	Compression EXRCompression
+}
+
+// NewEXROptions возвращает half каналы со сжатием ZIP, как пишет большинство пакетов
+func NewEXROptions() EXROptions {
+	return EXROptions{PixelType: EXRHalf, Compression: EXRZipCompression}
+}
+
+// ParseEXROptions разбирает тип пикселей (half, float) и сжатие (none, zip)
+func ParseEXROptions(pixelType, compression string) (EXROptions, error) {
+	options := NewEXROptions()
+
+	switch pixelType {
+	case "half":
+		options.PixelType = EXRHalf
+	case "float":
+		options.PixelType = EXRFloat
+	default:
+		return options, fmt.Errorf("unknown EXR pixel type %q (expected half or float)", pixelType)
+	}
+
+	switch compression {
+	case "none":
+		options.Compression = EXRNoCompression
+	case "zip":
+		options.Compression = EXRZipCompression
+	default:
+		return options, fmt.Errorf("unknown EXR compression %q (expected none or zip)", compression)
+	}
+	return options, nil
+}
+
+// EXRChannel - канал изображения: значения построчно сверху вниз, по одному на пиксель
+type EXRChannel struct {
+	Name string
+	Data []float32
+}
+
+// RGBChannels раскладывает чередующийся RGB буфер на каналы с префиксом слоя
+// ("" для основного изображения, иначе "layer.R" и т.д.)
+func RGBChannels(layer string, rgb []float32) []EXRChannel {
+	return layerChannels(layer, []string{"R", "G", "B"}, rgb)
+}
+
+// layerChannels раскладывает буфер с чередующимися каналами names на отдельные каналы слоя layer
+func layerChannels(layer string, names []string, data []float32) []EXRChannel {
+	prefix := ""
+	if layer != "" {
+		prefix = layer + "."
+	}
+
+	channels := make([]EXRChannel, len(names))
+	for c, name := range names {
+		channels[c] = EXRChannel{Name: prefix + name, Data: make([]float32, len(data)/len(names))}
+		for i := range channels[c].Data {
+			channels[c].Data[i] = data[len(names)*i+c]
+		}
+	}
+	return channels
+}
+
+// WriteEXR записывает однокомпонентный scanline файл OpenEXR с произвольным набором каналов
+func WriteEXR(w io.Writer, width, height int, channels []EXRChannel, options EXROptions) error {
+	if width <= 0 || height <= 0 {
+		return fmt.Errorf("exr: invalid image size %dx%d", width, height)
+	}
+	for _, c := range channels {
+		if len(c.Data) != width*height {
+			return fmt.Errorf("exr: channel %q has %d values, expected %d", c.Name, len(c.Data), width*height)
+		}
+	}
+
+	// Каналы в файле обязаны идти по алфавиту
+	channels = append([]EXRChannel(nil), channels...)
+	sort.Slice(channels, func(i, j int) bool { return channels[i].Name < channels[j].Name })
+
+	linesPerBlock := 1
+	if options.Compression == EXRZipCompression {
+		linesPerBlock = 16
+	}
+
+	var header bytes.Buffer
+	header.Write([]byte{0x76, 0x2f, 0x31, 0x01}) // Магическое число
+	header.Write([]byte{2, 0, 0, 0})             // Версия 2, одна часть, scanline
+
+	var chlist bytes.Buffer
+	for _, c := range channels {
+		chlist.WriteString(c.Name)
+		chlist.WriteByte(0)
+		binary.Write(&chlist, binary.LittleEndian, int32(options.PixelType))
+		chlist.Write([]byte{0, 0, 0, 0}) // pLinear и зарезервированные байты
+		binary.Write(&chlist, binary.LittleEndian, [2]int32{1, 1})
+	}
+	chlist.WriteByte(0)
+
+	window := [4]int32{0, 0, int32(width - 1), int32(height - 1)}
+	writeEXRAttribute(&header, "channels", "chlist", chlist.Bytes())
+	writeEXRAttribute(&header, "compression", "compression", []byte{byte(options.Compression)})
+	writeEXRAttribute(&header, "dataWindow", "box2i", littleEndian(window))
+	writeEXRAttribute(&header, "displayWindow", "box2i", littleEndian(window))
+	writeEXRAttribute(&header, "lineOrder", "lineOrder", []byte{0}) // INCREASING_Y
+	writeEXRAttribute(&header, "pixelAspectRatio", "float", littleEndian(float32(1)))
+	writeEXRAttribute(&header, "screenWindowCenter", "v2f", littleEndian([2]float32{0, 0}))
+	writeEXRAttribute(&header, "screenWindowWidth", "float", littleEndian(float32(1)))
+	header.WriteByte(0)
+
+	// Блоки строк собираются заранее, чтобы заполнить таблицу смещений
+	blockCount := (height + linesPerBlock - 1) / linesPerBlock
+	blocks := make([][]byte, blockCount)
+	for b := range blocks {
+		y0 := b * linesPerBlock
+		y1 := min(height, y0+linesPerBlock)
+		data := encodeEXRLines(width, y0, y1, channels, options.PixelType)
+		if options.Compression == EXRZipCompression {
+			var err error
+			if data, err = zipEXRBlock(data); err != nil {
+				return err
+			}
+		}
+		blocks[b] = data
+	}
+
+	out := bufio.NewWriter(w)
+	out.Write(header.Bytes())
+
+	offset := uint64(header.Len() + 8*blockCount)
+	for _, data := range blocks {
+		binary.Write(out, binary.LittleEndian, offset)
+		offset += uint64(8 + len(data))
+	}
+	for b, data := range blocks {
+		binary.Write(out, binary.LittleEndian, int32(b*linesPerBlock))
+		binary.Write(out, binary.LittleEndian, int32(len(data)))
+		if _, err := out.Write(data); err != nil {
+			return err
+		}
+	}
+	return out.Flush()
+}
+
+func writeEXRAttribute(header *bytes.Buffer, name, typeName string, value []byte) {
+	header.WriteString(name)
+	header.WriteByte(0)
+	header.WriteString(typeName)
+	header.WriteByte(0)
+	binary.Write(header, binary.LittleEndian, int32(len(value)))
+	header.Write(value)
+}
+
+func littleEndian(v any) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, v)
+	return buf.Bytes()
+}
+
+// encodeEXRLines упаковывает строки [y0, y1): в каждой строке каналы идут подряд
+func encodeEXRLines(width, y0, y1 int, channels []EXRChannel, pixelType EXRPixelType) []byte {
+	size := 4
+	if pixelType == EXRHalf {
+		size = 2
+	}
+
+	data := make([]byte, 0, (y1-y0)*len(channels)*width*size)
+	for y := y0; y < y1; y++ {
+		for _, c := range channels {
+			for _, v := range c.Data[y*width : (y+1)*width] {
+				if pixelType == EXRHalf {
+					data = binary.LittleEndian.AppendUint16(data, floatToHalf(v))
+				} else {
+					data = binary.LittleEndian.AppendUint32(data, math.Float32bits(v))
+				}
+			}
+		}
+	}
+	return data
+}
+
+// zipEXRBlock сжимает блок как ZIP_COMPRESSION: байты раскладываются на чётные и нечётные,
+// заменяются разностями соседних и сжимаются zlib. Если сжатие не помогло, блок хранится как есть.
+func zipEXRBlock(raw []byte) ([]byte, error) {
+	tmp := make([]byte, len(raw))
+	half := (len(raw) + 1) / 2
+	for i, b := range raw {
+		if i%2 == 0 {
+			tmp[i/2] = b
+		} else {
+			tmp[half+i/2] = b
+		}
+	}
+
+	for i := len(tmp) - 1; i > 0; i-- {
+		tmp[i] = byte(int(tmp[i]) - int(tmp[i-1]) + 128)
+	}
+
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	if _, err := zw.Write(tmp); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	if buf.Len() >= len(raw) {
+		return raw, nil
+	}
+	return buf.Bytes(), nil
+}
+
+// floatToHalf переводит float32 в IEEE 754 half с округлением к ближайшему чётному
+func floatToHalf(f float32) uint16 {
+	bits := math.Float32bits(f)
+	sign := uint16(bits>>16) & 0x8000
+	exponent := int(bits>>23&0xff) - 127 + 15
+	mantissa := bits & 0x7fffff
+
+	switch {
+	case bits&0x7fffffff == 0:
+		return sign
+	case bits>>23&0xff == 0xff:
+		// Бесконечность или NaN
+		if mantissa != 0 {
+			return sign | 0x7e00
+		}
+		return sign | 0x7c00
+	case exponent >= 0x1f:
+		return sign | 0x7c00
+	case exponent <= 0:
+		// Денормализованное число или ноль
+		if exponent < -10 {
+			return sign
+		}
+		mantissa |= 0x800000
+		shift := uint(14 - exponent)
+		half := mantissa >> shift
+		rest := mantissa & (1<<shift - 1)
+		midpoint := uint32(1) << (shift - 1)
+		if rest > midpoint || (rest == midpoint && half&1 == 1) {
+			half++
+		}
+		return sign | uint16(half)
+	}
+
+	half := uint32(exponent)<<10 | mantissa>>13
+	rest := mantissa & 0x1fff
+	if rest > 0x1000 || (rest == 0x1000 && half&1 == 1) {
+		// Перенос в порядок корректен, в том числе переполнение до бесконечности
+		half++
+	}
+	return sign | uint16(half)
+}
@@ -0,0 +1,271 @@
+package tracer
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io"
+	"math"
+	"slices"
+	"testing"
+)
+
+// exrFile - разобранный тестом однокомпонентный scanline файл OpenEXR
+type exrFile struct {
+	attributes map[string][]byte // Значения атрибутов заголовка по имени
+	types      map[string]string // Типы атрибутов по имени
+	channels   []string          // Каналы в порядке записи
+	pixelTypes []EXRPixelType
+	offsets    []uint64
+	compressed int                  // Блоков, сохранённых сжатыми
+	values     map[string][]float32 // Значения каналов построчно сверху вниз
+}
+
+// readEXR разбирает вывод WriteEXR: заголовок, таблицу смещений и блоки строк
+func readEXR(t *testing.T, data []byte, width, height, linesPerBlock int) exrFile {
+	t.Helper()
+	if !bytes.HasPrefix(data, []byte{0x76, 0x2f, 0x31, 0x01, 2, 0, 0, 0}) {
+		t.Fatalf("bad magic number or version: % x", data[:8])
+	}
+
+	f := exrFile{attributes: map[string][]byte{}, types: map[string]string{}, values: map[string][]float32{}}
+	pos := 8
+	cstring := func() string {
+		end := pos + bytes.IndexByte(data[pos:], 0)
+		s := string(data[pos:end])
+		pos = end + 1
+		return s
+	}
+	for data[pos] != 0 {
+		name, typeName := cstring(), cstring()
+		size := int(binary.LittleEndian.Uint32(data[pos:]))
+		pos += 4
+		f.attributes[name], f.types[name] = data[pos:pos+size], typeName
+		pos += size
+	}
+	pos++
+
+	chlist := f.attributes["channels"]
+	for len(chlist) > 1 {
+		end := bytes.IndexByte(chlist, 0)
+		f.channels = append(f.channels, string(chlist[:end]))
+		f.pixelTypes = append(f.pixelTypes, EXRPixelType(binary.LittleEndian.Uint32(chlist[end+1:])))
+		if sampling := chlist[end+9 : end+17]; !bytes.Equal(sampling, []byte{1, 0, 0, 0, 1, 0, 0, 0}) {
+			t.Errorf("channel %s sampling % x, want 1, 1", f.channels[len(f.channels)-1], sampling)
+		}
+		chlist = chlist[end+17:]
+	}
+
+	blocks := (height + linesPerBlock - 1) / linesPerBlock
+	for b := 0; b < blocks; b++ {
+		f.offsets = append(f.offsets, binary.LittleEndian.Uint64(data[pos:]))
+		pos += 8
+	}
+	if f.offsets[0] != uint64(pos) {
+		t.Errorf("first block at %d, want right after the offset table at %d", f.offsets[0], pos)
+	}
+
+	for _, c := range f.channels {
+		f.values[c] = make([]float32, 0, width*height)
+	}
+	for b, offset := range f.offsets {
+		y := int(int32(binary.LittleEndian.Uint32(data[offset:])))
+		size := int(binary.LittleEndian.Uint32(data[offset+4:]))
+		if y != b*linesPerBlock {
+			t.Fatalf("block %d starts at line %d, want %d", b, y, b*linesPerBlock)
+		}
+		if b+1 < len(f.offsets) && f.offsets[b+1] != offset+8+uint64(size) {
+			t.Fatalf("block %d ends at %d, next offset is %d", b, offset+8+uint64(size), f.offsets[b+1])
+		}
+		if b+1 == len(f.offsets) && int(offset)+8+size != len(data) {
+			t.Fatalf("last block ends at %d, file size %d", int(offset)+8+size, len(data))
+		}
+
+		lines := min(linesPerBlock, height-y)
+		rawSize := 0
+		for _, pt := range f.pixelTypes {
+			rawSize += lines * width * exrValueSize(pt)
+		}
+		block := data[offset+8 : int(offset)+8+size]
+		if size < rawSize {
+			block = unzipEXRBlock(t, block, rawSize)
+			f.compressed++
+		} else if size != rawSize {
+			t.Fatalf("block %d has %d bytes, more than %d uncompressed", b, size, rawSize)
+		}
+
+		for line := 0; line < lines; line++ {
+			for c, name := range f.channels {
+				for x := 0; x < width; x++ {
+					var v float32
+					if f.pixelTypes[c] == EXRHalf {
+						v = halfToFloat(binary.LittleEndian.Uint16(block))
+					} else {
+						v = math.Float32frombits(binary.LittleEndian.Uint32(block))
+					}
+					block = block[exrValueSize(f.pixelTypes[c]):]
+					f.values[name] = append(f.values[name], v)
+				}
+			}
+		}
+	}
+	return f
+}
+
+func exrValueSize(pt EXRPixelType) int {
+	if pt == EXRHalf {
+		return 2
+	}
+	return 4
+}
+
+// unzipEXRBlock обращает zipEXRBlock: zlib, разности соседних байтов и раскладку на чётные и нечётные
+func unzipEXRBlock(t *testing.T, block []byte, rawSize int) []byte {
+	t.Helper()
+	zr, err := zlib.NewReader(bytes.NewReader(block))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmp, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tmp) != rawSize {
+		t.Fatalf("block unpacks to %d bytes, want %d", len(tmp), rawSize)
+	}
+
+	for i := 1; i < len(tmp); i++ {
+		tmp[i] = byte(int(tmp[i-1]) + int(tmp[i]) - 128)
+	}
+	raw := make([]byte, len(tmp))
+	half := (len(tmp) + 1) / 2
+	for i := range raw {
+		if i%2 == 0 {
+			raw[i] = tmp[i/2]
+		} else {
+			raw[i] = tmp[half+i/2]
+		}
+	}
+	return raw
+}
+
+// halfToFloat переводит IEEE 754 half в float32
+func halfToFloat(h uint16) float32 {
+	sign := float32(1)
+	if h&0x8000 != 0 {
+		sign = -1
+	}
+	exponent, mantissa := int(h>>10&0x1f), float64(h&0x3ff)
+	switch exponent {
+	case 0:
+		return sign * float32(math.Ldexp(mantissa, -24))
+	case 0x1f:
+		if mantissa != 0 {
+			return float32(math.NaN())
+		}
+		return sign * float32(math.Inf(1))
+	}
+	return sign * float32(math.Ldexp(1+mantissa/1024, exponent-15))
+}
+
+// Заголовок, таблица смещений и блоки читаются обратно для half и float, со сжатием и без.
+// Высота не кратна 16, так что последний блок ZIP неполный.
+func TestWriteEXR(t *testing.T) {
+	const width, height = 5, 19
+
+	// Значения кратны 1/8 и точно представимы в half
+	rgb := make([]float32, 3*width*height)
+	for i := range rgb {
+		rgb[i] = float32(i%64)/8 - 4
+	}
+	depth := make([]float32, width*height)
+	for i := range depth {
+		depth[i] = float32(i / width)
+	}
+	channels := append(RGBChannels("", rgb), EXRChannel{Name: "depth.Z", Data: depth})
+
+	for _, pixelType := range []EXRPixelType{EXRHalf, EXRFloat} {
+		for _, compression := range []EXRCompression{EXRNoCompression, EXRZipCompression} {
+			var buf bytes.Buffer
+			if err := WriteEXR(&buf, width, height, channels, EXROptions{PixelType: pixelType, Compression: compression}); err != nil {
+				t.Fatal(err)
+			}
+			linesPerBlock := 1
+			if compression == EXRZipCompression {
+				linesPerBlock = 16
+			}
+			f := readEXR(t, buf.Bytes(), width, height, linesPerBlock)
+
+			if want := []string{"B", "G", "R", "depth.Z"}; !slices.Equal(f.channels, want) {
+				t.Errorf("channels %v, want sorted %v", f.channels, want)
+			}
+			for i, pt := range f.pixelTypes {
+				if pt != pixelType {
+					t.Errorf("channel %s has pixel type %d, want %d", f.channels[i], pt, pixelType)
+				}
+			}
+			if c := f.attributes["compression"]; len(c) != 1 || EXRCompression(c[0]) != compression {
+				t.Errorf("compression attribute % x, want %d", c, compression)
+			}
+			window := littleEndian([4]int32{0, 0, width - 1, height - 1})
+			for _, name := range []string{"dataWindow", "displayWindow"} {
+				if f.types[name] != "box2i" || !bytes.Equal(f.attributes[name], window) {
+					t.Errorf("%s is %s % x, want box2i % x", name, f.types[name], f.attributes[name], window)
+				}
+			}
+			if compression == EXRZipCompression && f.compressed == 0 {
+				t.Errorf("type %d: no block is stored compressed", pixelType)
+			}
+			if !bytes.Equal(f.attributes["lineOrder"], []byte{0}) {
+				t.Errorf("line order % x, want increasing y", f.attributes["lineOrder"])
+			}
+
+			for _, c := range channels {
+				if got := f.values[c.Name]; !slices.Equal(got, c.Data) {
+					t.Fatalf("type %d, compression %d: channel %s is %v, want %v", pixelType, compression, c.Name, got, c.Data)
+				}
+			}
+		}
+	}
+}
+
+// Округление к ближайшему чётному в нормальном и денормализованном диапазонах, переполнение и NaN
+func TestFloatToHalf(t *testing.T) {
+	denormal := func(m float64) float32 { return float32(math.Ldexp(m, -24)) } // m наименьших денормализованных
+	for _, tc := range []struct {
+		name string
+		in   float32
+		want uint16
+	}{
+		{"zero", 0, 0x0000},
+		{"negative zero", float32(math.Copysign(0, -1)), 0x8000},
+		{"one", 1, 0x3c00},
+		{"minus two", -2, 0xc000},
+		{"smallest denormal", denormal(1), 0x0001},
+		{"largest denormal", denormal(1023), 0x03ff},
+		{"smallest normal", float32(math.Ldexp(1, -14)), 0x0400},
+		{"half of smallest denormal rounds to even zero", denormal(0.5), 0x0000},
+		{"just above half of smallest denormal", denormal(0.5) * 1.0001, 0x0001},
+		{"denormal tie rounds up to even", denormal(1.5), 0x0002},
+		{"denormal tie rounds down to even", denormal(2.5), 0x0002},
+		{"below denormal range", denormal(0.25), 0x0000},
+		{"normal tie rounds down to even", 1 + float32(math.Ldexp(1, -11)), 0x3c00},
+		{"normal tie rounds up to even", 1 + float32(math.Ldexp(3, -11)), 0x3c02},
+		{"above the tie rounds up", 1 + float32(math.Ldexp(1, -11)) + float32(math.Ldexp(1, -20)), 0x3c01},
+		{"largest half", 65504, 0x7bff},
+		{"rounds down to largest half", 65519, 0x7bff},
+		{"tie above largest half overflows", 65520, 0x7c00},
+		{"overflow", 1e6, 0x7c00},
+		{"negative overflow", -1e6, 0xfc00},
+		{"infinity", float32(math.Inf(1)), 0x7c00},
+		{"negative infinity", float32(math.Inf(-1)), 0xfc00},
+	} {
+		if got := floatToHalf(tc.in); got != tc.want {
+			t.Errorf("%s: floatToHalf(%g) = %#04x, want %#04x", tc.name, tc.in, got, tc.want)
+		}
+	}
+
+	if h := floatToHalf(float32(math.NaN())); h&0x7c00 != 0x7c00 || h&0x3ff == 0 {
+		t.Errorf("NaN converted to %#04x, want a half NaN", h)
+	}
+}
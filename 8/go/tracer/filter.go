@@ -0,0 +1,230 @@
+package tracer
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"sync"
+)
+
+// FilterType - фильтр восстановления изображения по сэмплам
+type FilterType int
+
+const (
+	FilterBox      FilterType = iota // Среднее сэмплов в квадрате
+	FilterTent                       // Линейно убывающий вес
+	FilterGaussian                   // Гауссиана, обрезанная на радиусе
+	FilterMitchell                   // Mitchell–Netravali с B = C = 1/3
+	FilterLanczos                    // Sinc с окном Ланцоша
+)
+
+var filterTypeNames = map[FilterType]string{
+	FilterBox:      "box",
+	FilterTent:     "tent",
+	FilterGaussian: "gaussian",
+	FilterMitchell: "mitchell",
+	FilterLanczos:  "lanczos",
+}
+
+// FilterTypes - фильтры в порядке перечисления
+var FilterTypes = []FilterType{FilterBox, FilterTent, FilterGaussian, FilterMitchell, FilterLanczos}
+
+// defaultFilterRadius - радиусы по умолчанию в пикселях
+var defaultFilterRadius = map[FilterType]float64{
+	FilterBox:      0.5,
+	FilterTent:     1,
+	FilterGaussian: 1.5,
+	FilterMitchell: 2,
+	FilterLanczos:  3,
+}
+
+func (t FilterType) String() string {
+	if name, ok := filterTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("FilterType(%d)", int(t))
+}
+
+// ParseFilterType разбирает название фильтра восстановления
+func ParseFilterType(name string) (FilterType, error) {
+	for _, t := range FilterTypes {
+		if t.String() == name {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown reconstruction filter %q (expected box, tent, gaussian, mitchell or lanczos)", name)
+}
+
+// Filter - разделимый фильтр восстановления: каждый сэмпл добавляется с весом
+// во все пиксели, центры которых ближе Radius по каждой оси
+type Filter struct {
+	Type   FilterType
+	Radius float64 // Радиус в пикселях
+}
+
+// NewFilter создаёт фильтр; при radius <= 0 берётся радиус по умолчанию для типа
+func NewFilter(t FilterType, radius float64) Filter {
+	if radius <= 0 {
+		radius = defaultFilterRadius[t]
+	}
+	return Filter{Type: t, Radius: radius}
+}
+
+// Weight возвращает вес сэмпла, смещённого на (dx, dy) от центра пикселя
+func (f Filter) Weight(dx, dy float64) float64 {
+	return f.weight(dx) * f.weight(dy)
+}
+
+func (f Filter) weight(x float64) float64 {
+	r := f.Radius
+	switch f.Type {
+	case FilterTent:
+		return math.Max(0, r-math.Abs(x))
+	case FilterGaussian:
+		// σ = r/3, гауссиана сдвинута вниз, чтобы на радиусе вес был нулевым
+		alpha := 4.5 / (r * r)
+		return math.Max(0, math.Exp(-alpha*x*x)-math.Exp(-alpha*r*r))
+	case FilterMitchell:
+		return mitchell(2 * x / r)
+	case FilterLanczos:
+		if math.Abs(x) >= r {
+			return 0
+		}
+		return sinc(x) * sinc(x/r)
+	default:
+		// Полуинтервал, чтобы сэмпл на границе пикселей попал только в один из них
+		if x >= -r && x < r {
+			return 1
+		}
+		return 0
+	}
+}
+
+// mitchell - кубический фильтр Mitchell–Netravali (B = C = 1/3) на [-2, 2]
+func mitchell(x float64) float64 {
+	const b, c = 1.0 / 3, 1.0 / 3
+	x = math.Abs(x)
+	switch {
+	case x < 1:
+		return ((12-9*b-6*c)*x*x*x + (-18+12*b+6*c)*x*x + (6 - 2*b)) / 6
+	case x < 2:
+		return ((-b-6*c)*x*x*x + (6*b+30*c)*x*x + (-12*b-48*c)*x + (8*b + 24*c)) / 6
+	}
+	return 0
+}
+
+func sinc(x float64) float64 {
+	if math.Abs(x) < 1e-5 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+// film накапливает взвешенную сумму сэмплов по пикселям кадра.
+// Тайлы копят сэмплы в своих буферах и сливают их сюда под мьютексом,
+// так что сэмплы с краёв тайла попадают и в соседние тайлы.
+type film struct {
+	filter        Filter
+	width, height int
+
+	mu         sync.Mutex
+	sum        []Vector
+	weight     []float64
+	toneMapper ToneMapper // Компрессия, с которой слияния обновляют изображение кадра
+}
+
+func newFilm(width, height int, filter Filter, tm ToneMapper) *film {
+	return &film{
+		filter:     filter,
+		width:      width,
+		height:     height,
+		sum:        make([]Vector, width*height),
+		weight:     make([]float64, width*height),
+		toneMapper: tm,
+	}
+}
+
+// setToneMapper меняет компрессию и перестраивает изображение dst. Под мьютексом слияний,
+// так что рабочие продолжают рендер, а ни один тайл не попадает в кадр со старой компрессией.
+func (f *film) setToneMapper(tm ToneMapper, dst *Frame) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.toneMapper = tm
+	dst.ToneMap(tm)
+}
+
+// clear обнуляет накопленные сэмплы
+func (f *film) clear() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	clear(f.sum)
+	clear(f.weight)
+}
+
+// filmTile - буфер сэмплов тайла, расширенного на радиус фильтра
+type filmTile struct {
+	film   *film
+	bounds image.Rectangle
+	sum    []Vector
+	weight []float64
+}
+
+// tile создаёт буфер для сэмплов пикселей tile
+func (f *film) tile(tile image.Rectangle) *filmTile {
+	margin := int(math.Ceil(f.filter.Radius - 0.5))
+	bounds := tile.Inset(-margin).Intersect(image.Rect(0, 0, f.width, f.height))
+	size := bounds.Dx() * bounds.Dy()
+	return &filmTile{
+		film:   f,
+		bounds: bounds,
+		sum:    make([]Vector, size),
+		weight: make([]float64, size),
+	}
+}
+
+// add добавляет сэмпл пикселя (x, y), смещённый на offset от его центра, во все пиксели под фильтром
+func (t *filmTile) add(x, y int, offset Vector, c Vector) {
+	filter := t.film.filter
+	sx, sy := float64(x)+offset.X, float64(y)+offset.Y
+
+	x0 := max(t.bounds.Min.X, int(math.Ceil(sx-filter.Radius)))
+	x1 := min(t.bounds.Max.X-1, int(math.Floor(sx+filter.Radius)))
+	y0 := max(t.bounds.Min.Y, int(math.Ceil(sy-filter.Radius)))
+	y1 := min(t.bounds.Max.Y-1, int(math.Floor(sy+filter.Radius)))
+	for py := y0; py <= y1; py++ {
+		wy := filter.weight(sy - float64(py))
+		if wy == 0 {
+			continue
+		}
+		for px := x0; px <= x1; px++ {
+			w := filter.weight(sx-float64(px)) * wy
+			if w == 0 {
+				continue
+			}
+			i := (py-t.bounds.Min.Y)*t.bounds.Dx() + px - t.bounds.Min.X
+			t.sum[i] = t.sum[i].Add(c.Mul(w))
+			t.weight[i] += w
+		}
+	}
+}
+
+// merge сливает сэмплы тайла в плёнку и обновляет затронутые пиксели кадра dst
+func (f *film) merge(t *filmTile, dst *Frame) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for y := t.bounds.Min.Y; y < t.bounds.Max.Y; y++ {
+		for x := t.bounds.Min.X; x < t.bounds.Max.X; x++ {
+			i := (y-t.bounds.Min.Y)*t.bounds.Dx() + x - t.bounds.Min.X
+			if t.weight[i] == 0 {
+				continue
+			}
+			j := y*f.width + x
+			f.sum[j] = f.sum[j].Add(t.sum[i])
+			f.weight[j] += t.weight[i]
+			if f.weight[j] > 0 {
+				dst.Set(x, y, f.sum[j].Div(f.weight[j]), f.toneMapper)
+			}
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package tracer
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+// Сплаттинг не зависит от разбиения на тайлы и совпадает в тайловом и прогрессивном рендере
+func TestFilterSplatting(t *testing.T) {
+	const width, height, samples = 40, 20, 2
+
+	for _, filterType := range FilterTypes {
+		t.Run(filterType.String(), func(t *testing.T) {
+			newRenderer := func(tileSize int) *Renderer {
+				r := NewRenderer(testScene(width, height), width, height)
+				r.SamplesPerPixel = samples
+				r.Sampler = NewIndependentSampler(7)
+				r.Filter = NewFilter(filterType, 0)
+				r.Scheduler = Scheduler{TileSize: tileSize, Order: TileOrderSpiral, Workers: 2}
+				return r
+			}
+
+			reference, err := newRenderer(32).Render(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			tiled, err := newRenderer(5).Render(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			progressive := NewProgressive(newRenderer(7), samples)
+			progressive.Start(context.Background())
+			for !progressive.Converged() {
+				time.Sleep(time.Millisecond)
+			}
+			progressive.Stop()
+
+			for name, frame := range map[string]*Frame{"tiles of 5": tiled, "progressive": progressive.Frame()} {
+				for i, v := range frame.Radiance {
+					if want := reference.Radiance[i]; math.Abs(float64(v-want)) > 1e-5*(1+math.Abs(float64(want))) {
+						t.Fatalf("%s: pixel %d channel %d is %g, want %g", name, i/3, i%3, v, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestFilterWeights(t *testing.T) {
+	for _, filterType := range FilterTypes {
+		f := NewFilter(filterType, 0)
+		if w := f.Weight(0, 0); w <= 0 {
+			t.Errorf("%v: weight at the center is %g", filterType, w)
+		}
+		if w := f.Weight(f.Radius+0.01, 0); w != 0 {
+			t.Errorf("%v: weight beyond the radius is %g", filterType, w)
+		}
+	}
+
+	// Прямоугольный фильтр радиуса 0.5 относит сэмпл на границе ровно к одному пикселю
+	box := NewFilter(FilterBox, 0)
+	if box.Weight(-0.5, 0) != 1 || box.Weight(0.5, 0) != 0 {
+		t.Errorf("box filter must cover the half-open interval [-0.5, 0.5)")
+	}
+}
@@ -0,0 +1,145 @@
+package tracer
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"slices"
+)
+
+// Frame - результат рендера: линейная HDR яркость, её 8-битное sRGB отображение
+// и количество сэмплов по пикселям
+type Frame struct {
+	Width, Height int
+	Radiance      []float32   // Линейная яркость, по три канала RGB на пиксель
+	Image         *image.RGBA // Яркость после тональной компрессии и кодирования в sRGB
+	Samples       []int
+
+	// Признаки первого пересечения, усреднённые по сэмплам (для денойзера)
+	Albedo []float32 // Диффузный цвет, по три канала на пиксель
+	Normal []float32 // Нормаль, по три компоненты на пиксель
+	Depth  []float32 // Расстояние от камеры, 0 для окружения
+
+	Variance []float32 // Дисперсия средней яркости пикселя, -1 если сэмплов меньше двух
+
+	AOVs map[AOV][]float32 // Дополнительные проходы, кроме признаков (см. EnableAOVs)
+}
+
+// NewFrame создаёт пустой кадр
+func NewFrame(width, height int) *Frame {
+	return &Frame{
+		Width:    width,
+		Height:   height,
+		Radiance: make([]float32, 3*width*height),
+		Image:    image.NewRGBA(image.Rect(0, 0, width, height)),
+		Samples:  make([]int, width*height),
+		Albedo:   make([]float32, 3*width*height),
+		Normal:   make([]float32, 3*width*height),
+		Depth:    make([]float32, width*height),
+		Variance: make([]float32, width*height),
+	}
+}
+
+// NewFrameFromRadiance создаёт кадр из готовой линейной яркости, например для сохранения окружения
+func NewFrameFromRadiance(width, height int, rgb []float32, tm ToneMapper) *Frame {
+	f := NewFrame(width, height)
+	copy(f.Radiance, rgb)
+	f.ToneMap(tm)
+	return f
+}
+
+// Set записывает яркость пикселя и обновляет его отображение
+func (f *Frame) Set(x, y int, c Vector, tm ToneMapper) {
+	i := 3 * (y*f.Width + x)
+	f.Radiance[i] = float32(c.X)
+	f.Radiance[i+1] = float32(c.Y)
+	f.Radiance[i+2] = float32(c.Z)
+	f.Image.SetRGBA(x, y, tm.Encode(c))
+}
+
+// SetFeatures записывает признаки первого пересечения пикселя, дисперсию его яркости и собираемые проходы
+func (f *Frame) SetFeatures(x, y int, features Features, variance float64) {
+	i := y*f.Width + x
+	f.Albedo[3*i] = float32(features.Albedo.X)
+	f.Albedo[3*i+1] = float32(features.Albedo.Y)
+	f.Albedo[3*i+2] = float32(features.Albedo.Z)
+	f.Normal[3*i] = float32(features.Normal.X)
+	f.Normal[3*i+1] = float32(features.Normal.Y)
+	f.Normal[3*i+2] = float32(features.Normal.Z)
+	f.Depth[i] = float32(features.Depth)
+	f.Variance[i] = float32(variance)
+	f.setAOVs(i, features)
+}
+
+// Clone возвращает независимую копию кадра
+func (f *Frame) Clone() *Frame {
+	clone := *f
+	clone.Radiance = slices.Clone(f.Radiance)
+	clone.Samples = slices.Clone(f.Samples)
+	clone.Albedo = slices.Clone(f.Albedo)
+	clone.Normal = slices.Clone(f.Normal)
+	clone.Depth = slices.Clone(f.Depth)
+	clone.Variance = slices.Clone(f.Variance)
+	if f.AOVs != nil {
+		clone.AOVs = make(map[AOV][]float32, len(f.AOVs))
+		for a, data := range f.AOVs {
+			clone.AOVs[a] = slices.Clone(data)
+		}
+	}
+	clone.Image = image.NewRGBA(f.Image.Rect)
+	copy(clone.Image.Pix, f.Image.Pix)
+	return &clone
+}
+
+// RadianceAt возвращает линейную яркость пикселя
+func (f *Frame) RadianceAt(x, y int) Vector {
+	i := 3 * (y*f.Width + x)
+	return Vector{float64(f.Radiance[i]), float64(f.Radiance[i+1]), float64(f.Radiance[i+2])}
+}
+
+// ToneMap заново строит 8-битное изображение из HDR буфера, например после смены экспозиции
+func (f *Frame) ToneMap(tm ToneMapper) {
+	for y := 0; y < f.Height; y++ {
+		for x := 0; x < f.Width; x++ {
+			f.Image.SetRGBA(x, y, tm.Encode(f.RadianceAt(x, y)))
+		}
+	}
+}
+
+// Clear обнуляет кадр
+func (f *Frame) Clear() {
+	clear(f.Radiance)
+	clear(f.Image.Pix)
+	clear(f.Samples)
+	clear(f.Albedo)
+	clear(f.Normal)
+	clear(f.Depth)
+	clear(f.Variance)
+	for _, data := range f.AOVs {
+		clear(data)
+	}
+}
+
+// SampleHeatmap раскрашивает количество сэмплов по пикселям: от синего (мало) до красного (предел)
+func (f *Frame) SampleHeatmap() *image.RGBA {
+	maxSamples := 1
+	for _, n := range f.Samples {
+		maxSamples = max(maxSamples, n)
+	}
+
+	heatmap := image.NewRGBA(image.Rect(0, 0, f.Width, f.Height))
+	for i, n := range f.Samples {
+		r, g, b := heatColor(float64(n) / float64(maxSamples)).ToRGB()
+		heatmap.Set(i%f.Width, i/f.Width, color.RGBA{R: uint8(r), G: uint8(g), B: uint8(b), A: 255})
+	}
+	return heatmap
+}
+
+// heatColor переводит t из [0, 1] в цвет шкалы синий - голубой - зелёный - жёлтый - красный
+func heatColor(t float64) Vector {
+	stops := []Vector{{0, 0, 0.5}, {0, 0.6, 1}, {0, 0.8, 0.2}, {1, 1, 0}, {1, 0, 0}}
+	t = math.Max(0, math.Min(1, t)) * float64(len(stops)-1)
+	i := min(int(t), len(stops)-2)
+	f := t - float64(i)
+	return stops[i].Mul(1 - f).Add(stops[i+1].Mul(f))
+}
@@ -0,0 +1,315 @@
+package tracer
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Эталонные изображения перегенерируются командой go test ./tracer -run TestGolden -update
+var update = flag.Bool("update", false, "перезаписать эталонные изображения в testdata/golden")
+
+const (
+	goldenDir = "testdata/golden" // Эталонные изображения
+	failedDir = "testdata/failed" // Результат и разница для упавших сцен
+)
+
+// goldenCase - эталонная сцена и допуски сравнения
+type goldenCase struct {
+	name          string
+	width, height int
+	samples       int
+	scene         func(width, height int) *Scene
+	setup         func(r *Renderer) // Дополнительная настройка рендерера
+
+	tolerance    int     // Допустимая разница канала пикселя (0-255)
+	maxBadPixels float64 // Доля пикселей, которым разрешено выйти за tolerance
+	minPSNR      float64 // Минимальное пиковое отношение сигнал/шум, дБ
+}
+
+// Допуски покрывают расхождения вычислений с плавающей точкой между платформами
+// (например, слитное умножение-сложение на arm64)
+func (c goldenCase) withDefaults() goldenCase {
+	if c.samples == 0 {
+		c.samples = 4
+	}
+	if c.tolerance == 0 {
+		c.tolerance = 3
+	}
+	if c.maxBadPixels == 0 {
+		c.maxBadPixels = 0.005
+	}
+	if c.minPSNR == 0 {
+		c.minPSNR = 40
+	}
+	return c
+}
+
+var goldenCases = []goldenCase{
+	{
+		name:  "basic",
+		width: 64, height: 32,
+		scene: testScene,
+	},
+	{
+		name:  "pinhole",
+		width: 64, height: 32,
+		scene: func(width, height int) *Scene {
+			s := testScene(width, height)
+			s.Camera.Aperture = 0
+			return s
+		},
+	},
+	{
+		name:  "tetrahedron",
+		width: 48, height: 32,
+		scene: func(width, height int) *Scene {
+			tetrahedron := NewTetrahedron(
+				Vector{-1.5, 0, -0.8},
+				Vector{1.5, 0, -0.8},
+				Vector{0, -2.5, 0},
+				Vector{0, 0, 1.2},
+				Material{
+					DiffuseColor:  Vector{0.1, 0.1, 0.9},
+					SpecularColor: Vector{0.5, 0.5, 0.5},
+					AmbientColor:  Vector{0.1, 0.1, 0.1},
+					Shininess:     20,
+					Reflectivity:  0.3,
+				},
+			)
+			tetrahedron.ApplyTransform(Identity().
+				Multiply(Translate(0, 0, -4)).
+				Multiply(RotateY(math.Pi / 5)).
+				Multiply(Scale(1.2, 1.2, 1.2)))
+
+			s := testScene(width, height)
+			s.Objects = []SceneObject{tetrahedron, NewInfinityChessBoard(2, Vector{0, 0, 0}, Vector{1, 1, 1})}
+			s.Camera.Aperture = 0
+			return s
+		},
+	},
+	{
+		// Тор считается маршингом, поэтому кадр совсем маленький и с одним сэмплом
+		name:  "torus",
+		width: 24, height: 16,
+		samples: 1,
+		scene: func(width, height int) *Scene {
+			s := testScene(width, height)
+			s.Objects = []SceneObject{NewTorus(1.0, 0.3, Material{
+				DiffuseColor:  Vector{0.7, 1, 1},
+				SpecularColor: Vector{0.5, 0.5, 0.5},
+				AmbientColor:  Vector{0.1, 0.1, 0.1},
+				Shininess:     20,
+				Reflectivity:  0.3,
+			})}
+			s.Camera = NewCamera(Vector{0, -1.5, 3}, Vector{float64(width), float64(height), 0}, 60, 3, 0).
+				LookAt(Vector{0, 0, 0})
+			return s
+		},
+	},
+	{
+		name:  "orbit",
+		width: 48, height: 32,
+		scene: func(width, height int) *Scene {
+			s := testScene(width, height)
+			s.Camera = s.Camera.Orbit(Vector{-2, -1, -6}, 10, 35, 5)
+			return s
+		},
+	},
+	{
+		name:  "aces",
+		width: 64, height: 32,
+		scene: testScene,
+		setup: func(r *Renderer) {
+			r.ToneMapper = ToneMapper{Operator: ToneACES, Exposure: 1, WhitePoint: 4}
+		},
+	},
+	{
+		name:  "ibl",
+		width: 48, height: 24,
+		scene: func(width, height int) *Scene {
+			s := testScene(width, height)
+			sky := testHDRSky()
+			sky.Rotation = 30
+			sky.Intensity = 0.8
+			s.Skybox = sky
+			return s
+		},
+		setup: func(r *Renderer) {
+			r.EnvironmentSamples = 4
+			r.ToneMapper.Operator = ToneReinhard
+		},
+	},
+	{
+		name:  "sky",
+		width: 48, height: 24,
+		scene: func(width, height int) *Scene {
+			sky := NewProceduralSky(20, 40, DefaultTurbidity)
+			s := testScene(width, height)
+			s.Skybox = sky
+			s.Light = sky.SunLight()
+			return s
+		},
+		setup: func(r *Renderer) {
+			r.EnvironmentSamples = 2
+			r.ToneMapper.Operator = ToneACES
+		},
+	},
+	{
+		name:  "adaptive",
+		width: 48, height: 24,
+		scene: testScene,
+		setup: func(r *Renderer) {
+			r.Adaptive = NewAdaptiveSampling(4, 32, 0.02)
+		},
+	},
+}
+
+// TestGolden рендерит эталонные сцены с фиксированным seed и сравнивает их с testdata/golden
+func TestGolden(t *testing.T) {
+	for _, c := range goldenCases {
+		c := c.withDefaults()
+		t.Run(c.name, func(t *testing.T) {
+			got := renderGolden(t, c)
+			path := filepath.Join(goldenDir, c.name+".png")
+
+			if *update {
+				if err := os.MkdirAll(goldenDir, 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := SavePNG(path, got); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			want, err := loadPNG(path)
+			if err != nil {
+				t.Fatalf("%v (run with -update to create it)", err)
+			}
+
+			result, err := compareImages(got, want, c.tolerance)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			badFraction := float64(result.badPixels) / float64(c.width*c.height)
+			if badFraction <= c.maxBadPixels && result.psnr >= c.minPSNR {
+				return
+			}
+
+			if err := os.MkdirAll(failedDir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			actualPath := filepath.Join(failedDir, c.name+".actual.png")
+			diffPath := filepath.Join(failedDir, c.name+".diff.png")
+			if err := SavePNG(actualPath, got); err != nil {
+				t.Fatal(err)
+			}
+			if err := SavePNG(diffPath, result.diff); err != nil {
+				t.Fatal(err)
+			}
+			t.Errorf("%s: %d pixels (%.2f%%) differ by more than %d, max difference %d, PSNR %.1f dB (min %.1f); see %s",
+				c.name, result.badPixels, badFraction*100, c.tolerance, result.maxDiff, result.psnr, c.minPSNR, diffPath)
+		})
+	}
+}
+
+// renderGolden рендерит эталонную сцену с фиксированным seed
+func renderGolden(t *testing.T, c goldenCase) *image.RGBA {
+	t.Helper()
+
+	sampler, err := NewSampler("sobol", c.samples, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewRenderer(c.scene(c.width, c.height), c.width, c.height)
+	r.SamplesPerPixel = c.samples
+	r.Sampler = sampler
+	if c.setup != nil {
+		c.setup(r)
+	}
+
+	frame, err := r.Render(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return frame.Image
+}
+
+func loadPNG(path string) (*image.RGBA, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open golden image: %w", err)
+	}
+	defer file.Close()
+
+	img, err := png.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode golden image: %w", err)
+	}
+
+	rgba := image.NewRGBA(img.Bounds())
+	for y := img.Bounds().Min.Y; y < img.Bounds().Max.Y; y++ {
+		for x := img.Bounds().Min.X; x < img.Bounds().Max.X; x++ {
+			rgba.Set(x, y, img.At(x, y))
+		}
+	}
+	return rgba, nil
+}
+
+// comparison - результат попиксельного сравнения
+type comparison struct {
+	badPixels int         // Пикселей с разницей больше допуска
+	maxDiff   int         // Наибольшая разница канала
+	psnr      float64     // Пиковое отношение сигнал/шум, дБ (+Inf для совпадающих изображений)
+	diff      *image.RGBA // Разница, усиленная в 8 раз; пиксели вне допуска отмечены красным
+}
+
+func compareImages(got, want *image.RGBA, tolerance int) (comparison, error) {
+	if got.Bounds() != want.Bounds() {
+		return comparison{}, fmt.Errorf("image size %v differs from golden %v", got.Bounds(), want.Bounds())
+	}
+
+	bounds := got.Bounds()
+	result := comparison{diff: image.NewRGBA(bounds)}
+	squaredError := 0.0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			a := got.RGBAAt(x, y)
+			b := want.RGBAAt(x, y)
+			channels := [3]int{int(a.R) - int(b.R), int(a.G) - int(b.G), int(a.B) - int(b.B)}
+
+			pixelMax := 0
+			for _, d := range channels {
+				d = max(d, -d)
+				squaredError += float64(d * d)
+				pixelMax = max(pixelMax, d)
+			}
+			result.maxDiff = max(result.maxDiff, pixelMax)
+
+			if pixelMax > tolerance {
+				result.badPixels++
+				result.diff.SetRGBA(x, y, color.RGBA{R: 255, A: 255})
+				continue
+			}
+			amplified := uint8(min(255, pixelMax*8))
+			result.diff.SetRGBA(x, y, color.RGBA{R: amplified, G: amplified, B: amplified, A: 255})
+		}
+	}
+
+	mse := squaredError / float64(bounds.Dx()*bounds.Dy()*3)
+	result.psnr = math.Inf(1)
+	if mse > 0 {
+		result.psnr = 10 * math.Log10(255*255/mse)
+	}
+	return result, nil
+}
@@ -0,0 +1,61 @@
+package tracer
+
+// mix32 - финальное перемешивание битов (lowbias32, Chris Wellons)
+func mix32(x uint32) uint32 {
+	x ^= x >> 16
+	x *= 0x7feb352d
+	x ^= x >> 15
+	x *= 0x846ca68b
+	x ^= x >> 16
+	return x
+}
+
+// hashUint32 смешивает значения в одно 32-битное число
+func hashUint32(values ...uint32) uint32 {
+	h := uint32(0x9e3779b9)
+	for _, v := range values {
+		h = mix32(h ^ (v + 0x9e3779b9 + (h << 6) + (h >> 2)))
+	}
+	return h
+}
+
+// hashInts хеширует координаты пикселя
+func hashInts(x, y int) uint32 {
+	return hashUint32(uint32(x), uint32(y))
+}
+
+// permute возвращает i-й элемент случайной перестановки чисел [0, n), заданной seed
+// (Kensler, "Correlated Multi-Jittered Sampling")
+func permute(i, n, seed uint32) uint32 {
+	w := n - 1
+	w |= w >> 1
+	w |= w >> 2
+	w |= w >> 4
+	w |= w >> 8
+	w |= w >> 16
+
+	for {
+		i ^= seed
+		i *= 0xe170893d
+		i ^= seed >> 16
+		i ^= (i & w) >> 4
+		i ^= seed >> 8
+		i *= 0x0929eb3f
+		i ^= seed >> 23
+		i ^= (i & w) >> 1
+		i *= 1 | seed>>27
+		i *= 0x6935fa69
+		i ^= (i & w) >> 11
+		i *= 0x74dcb303
+		i ^= (i & w) >> 2
+		i *= 0x9e501cc3
+		i ^= (i & w) >> 2
+		i *= 0xc860a3df
+		i &= w
+		i ^= i >> 5
+		if i < n {
+			break
+		}
+	}
+	return (i + seed) % n
+}
@@ -1,4 +1,4 @@
-package main
+package tracer
 
 type DirectionalLight struct {
 	Direction     Vector
@@ -0,0 +1,152 @@
+package tracer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// LUT - трёхмерная таблица цветокоррекции в формате .cube (Adobe/Resolve).
+// Применяется к значениям sRGB в [0, 1] с трилинейной интерполяцией.
+type LUT struct {
+	Path      string  `json:"path"`      // Файл .cube, относительный путь - от файла сцены
+	Intensity float64 `json:"intensity"` // Доля результата таблицы: 0 - без изменений, 1 - полностью
+
+	size      int
+	table     []float32 // RGB узлов, красный меняется быстрее всего
+	domainMin Vector
+	domainMax Vector
+}
+
+// UnmarshalJSON разбирает настройки таблицы; сама таблица загружается методом Load
+func (l *LUT) UnmarshalJSON(data []byte) error {
+	type plain LUT
+	v := plain{Intensity: 1}
+	if err := unmarshalStrict(data, &v); err != nil {
+		return err
+	}
+	*l = LUT(v)
+	return nil
+}
+
+// Load читает таблицу из файла Path
+func (l *LUT) Load() error {
+	file, err := os.Open(l.Path)
+	if err != nil {
+		return fmt.Errorf("failed to open LUT: %w", err)
+	}
+	defer file.Close()
+
+	parsed, err := ReadCubeLUT(file)
+	if err != nil {
+		return fmt.Errorf("%s: %w", l.Path, err)
+	}
+	l.size, l.table, l.domainMin, l.domainMax = parsed.size, parsed.table, parsed.domainMin, parsed.domainMax
+	return nil
+}
+
+// ReadCubeLUT разбирает трёхмерную таблицу .cube
+func ReadCubeLUT(r io.Reader) (*LUT, error) {
+	l := &LUT{Intensity: 1, domainMax: Vector{1, 1, 1}}
+
+	parseTriple := func(fields []string) (Vector, error) {
+		if len(fields) != 3 {
+			return Vector{}, fmt.Errorf("expected 3 values, got %d", len(fields))
+		}
+		var v [3]float64
+		for i, f := range fields {
+			var err error
+			if v[i], err = strconv.ParseFloat(f, 64); err != nil {
+				return Vector{}, err
+			}
+		}
+		return Vector{v[0], v[1], v[2]}, nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		var err error
+		switch fields[0] {
+		case "TITLE":
+		case "LUT_3D_SIZE":
+			if len(fields) != 2 {
+				err = fmt.Errorf("LUT_3D_SIZE expects one value")
+			} else if l.size, err = strconv.Atoi(fields[1]); err == nil && (l.size < 2 || l.size > 256) {
+				err = fmt.Errorf("LUT_3D_SIZE %d out of range [2, 256]", l.size)
+			}
+		case "LUT_1D_SIZE":
+			err = fmt.Errorf("1D LUTs are not supported")
+		case "DOMAIN_MIN":
+			l.domainMin, err = parseTriple(fields[1:])
+		case "DOMAIN_MAX":
+			l.domainMax, err = parseTriple(fields[1:])
+		default:
+			if l.size == 0 {
+				err = fmt.Errorf("table data before LUT_3D_SIZE")
+				break
+			}
+			var c Vector
+			if c, err = parseTriple(fields); err == nil {
+				l.table = append(l.table, float32(c.X), float32(c.Y), float32(c.Z))
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cube line %d: %w", line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if l.size == 0 {
+		return nil, fmt.Errorf("cube: missing LUT_3D_SIZE")
+	}
+	if want := 3 * l.size * l.size * l.size; len(l.table) != want {
+		return nil, fmt.Errorf("cube: expected %d entries, got %d", want/3, len(l.table)/3)
+	}
+	return l, nil
+}
+
+// node возвращает цвет узла таблицы
+func (l *LUT) node(r, g, b int) Vector {
+	i := 3 * ((b*l.size+g)*l.size + r)
+	return Vector{float64(l.table[i]), float64(l.table[i+1]), float64(l.table[i+2])}
+}
+
+// Lookup возвращает цвет таблицы для c с трилинейной интерполяцией
+func (l *LUT) Lookup(c Vector) Vector {
+	scale := float64(l.size - 1)
+	coord := func(v, lo, hi float64) (int, float64) {
+		t := saturate((v-lo)/(hi-lo)) * scale
+		i := min(int(t), l.size-2)
+		return i, t - float64(i)
+	}
+	r, tr := coord(c.X, l.domainMin.X, l.domainMax.X)
+	g, tg := coord(c.Y, l.domainMin.Y, l.domainMax.Y)
+	b, tb := coord(c.Z, l.domainMin.Z, l.domainMax.Z)
+
+	lerp := func(a, b Vector, t float64) Vector { return a.Mul(1 - t).Add(b.Mul(t)) }
+	c00 := lerp(l.node(r, g, b), l.node(r+1, g, b), tr)
+	c10 := lerp(l.node(r, g+1, b), l.node(r+1, g+1, b), tr)
+	c01 := lerp(l.node(r, g, b+1), l.node(r+1, g, b+1), tr)
+	c11 := lerp(l.node(r, g+1, b+1), l.node(r+1, g+1, b+1), tr)
+	return lerp(lerp(c00, c10, tg), lerp(c01, c11, tg), tb)
+}
+
+func (l *LUT) apply(c Vector) Vector {
+	if l.table == nil {
+		return c
+	}
+	graded := l.Lookup(c)
+	t := math.Max(0, math.Min(1, l.Intensity))
+	return c.Mul(1 - t).Add(graded.Mul(t))
+}
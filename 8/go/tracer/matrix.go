@@ -1,4 +1,4 @@
-package main
+package tracer
 
 import "math"
 
@@ -61,3 +61,13 @@ func (m Matrix4x4) Multiply(other Matrix4x4) Matrix4x4 {
 	}
 	return result
 }
+
+// FromBasis строит матрицу поворота, столбцы которой - векторы базиса x, y, z
+func FromBasis(x, y, z Vector) Matrix4x4 {
+	return Matrix4x4{
+		{x.X, y.X, z.X, 0},
+		{x.Y, y.Y, z.Y, 0},
+		{x.Z, y.Z, z.Z, 0},
+		{0, 0, 0, 1},
+	}
+}
@@ -1,4 +1,4 @@
-package main
+package tracer
 
 type SceneObject interface {
 	Intersection(ray Ray) (IntersectionResult, bool)
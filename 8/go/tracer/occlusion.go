@@ -0,0 +1,80 @@
+package tracer
+
+import (
+	"math"
+	"slices"
+)
+
+const (
+	DefaultOcclusionSamples  = 8 // Лучей окклюзии на точку
+	DefaultOcclusionDistance = 3 // Дальность лучей окклюзии в единицах сцены
+)
+
+// AmbientOcclusion задаёт затенение фонового света: из точки выпускаются лучи по полусфере
+// с косинусным распределением, и фоновая составляющая умножается на долю незакрытых лучей.
+// Так щели и углы получают меньше фонового света, чем открытые поверхности.
+type AmbientOcclusion struct {
+	Samples     int     // Лучей на точку
+	MaxDistance float64 // Препятствия дальше не затеняют
+}
+
+// NewAmbientOcclusion создаёт настройки окклюзии, неположительные значения заменяются значениями по умолчанию
+func NewAmbientOcclusion(samples int, maxDistance float64) *AmbientOcclusion {
+	if samples <= 0 {
+		samples = DefaultOcclusionSamples
+	}
+	if maxDistance <= 0 {
+		maxDistance = DefaultOcclusionDistance
+	}
+	return &AmbientOcclusion{Samples: samples, MaxDistance: maxDistance}
+}
+
+// occlusionSettings возвращает настройки, с которыми считается окклюзия: заданные в рендерере
+// или по умолчанию для прохода ao и режима отладки ao. Если окклюзию ничто не использует,
+// например фоновую составляющую заменяет освещение окружением, а проход не собирается, возвращает false.
+func (r *Renderer) occlusionSettings() (AmbientOcclusion, bool) {
+	ambient := r.Occlusion != nil && !r.environmentLit()
+	if !ambient && r.Debug != DebugOcclusion && !slices.Contains(r.AOVs, AOVOcclusion) {
+		return AmbientOcclusion{}, false
+	}
+	if r.Occlusion != nil {
+		return *r.Occlusion, true
+	}
+	return *NewAmbientOcclusion(0, 0), true
+}
+
+// occlusion возвращает долю лучей из point по полусфере вокруг normal, которые не встретили
+// препятствий ближе ao.MaxDistance: 1 - точка открыта, 0 - полностью закрыта.
+// Косинусное распределение сокращается с косинусом в интеграле освещённости, поэтому доля не взвешивается.
+func (r *Renderer) occlusion(sampler Sampler, counters *rayCounters, ao AmbientOcclusion, point, normal Vector) float64 {
+	tangent, bitangent := orthonormalBasis(normal)
+	open := 0
+	for i := 0; i < ao.Samples; i++ {
+		u, v := sampler.Get2D()
+		direction := cosineHemisphere(normal, tangent, bitangent, u, v)
+
+		counters.ray(RayOcclusion)
+		ray := Ray{Origin: point.Add(normal.Mul(shadowBias)), Direction: direction}
+		if hit, _, found := ray.cast(r.Scene.Objects, counters); !found || hit.Distance > ao.MaxDistance {
+			open++
+		}
+	}
+	return float64(open) / float64(ao.Samples)
+}
+
+// cosineHemisphere переводит точку квадрата в направление полусферы вокруг normal с плотностью cos θ / π:
+// точка круга поднимается на полусферу (метод Малли)
+func cosineHemisphere(normal, tangent, bitangent Vector, u, v float64) Vector {
+	x, y := concentricDisk(u, v)
+	z := math.Sqrt(math.Max(0, 1-x*x-y*y))
+	return tangent.Mul(x).Add(bitangent.Mul(y)).Add(normal.Mul(z))
+}
+
+// orthonormalBasis строит два единичных вектора, перпендикулярных n и друг другу
+// (Duff et al., "Building an Orthonormal Basis, Revisited")
+func orthonormalBasis(n Vector) (Vector, Vector) {
+	sign := math.Copysign(1, n.Z)
+	a := -1 / (sign + n.Z)
+	b := n.X * n.Y * a
+	return Vector{1 + sign*n.X*n.X*a, sign * b, -sign * n.X}, Vector{b, sign + n.Y*n.Y*a, -n.Y}
+}
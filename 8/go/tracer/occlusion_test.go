@@ -0,0 +1,122 @@
+package tracer
+
+import (
+	"context"
+	"math"
+	"slices"
+	"testing"
+)
+
+// Направления лежат в полусфере нормали, а среднее cos θ при плотности cos θ / π равно 2/3
+func TestCosineHemisphere(t *testing.T) {
+	normal := Vector{1, 2, -3}.Normalize()
+	tangent, bitangent := orthonormalBasis(normal)
+	if math.Abs(tangent.Dot(normal)) > 1e-6 || math.Abs(bitangent.Dot(normal)) > 1e-6 || math.Abs(tangent.Dot(bitangent)) > 1e-6 {
+		t.Fatalf("basis %v, %v is not orthogonal to %v", tangent, bitangent, normal)
+	}
+
+	const n = 64
+	sum := 0.0
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			d := cosineHemisphere(normal, tangent, bitangent, (float64(i)+0.5)/n, (float64(j)+0.5)/n)
+			if math.Abs(d.Magnitude()-1) > 1e-6 || d.Dot(normal) < 0 {
+				t.Fatalf("direction %v is not a unit vector above the surface", d)
+			}
+			sum += d.Dot(normal)
+		}
+	}
+	if mean := sum / (n * n); math.Abs(mean-2.0/3) > 3e-3 {
+		t.Errorf("mean cosine %.4f, want 2/3", mean)
+	}
+}
+
+// Внутри сферы точка закрыта, снаружи открыта, а рядом со сферой закрыта только в пределах дальности
+func TestOcclusion(t *testing.T) {
+	scene := &Scene{Objects: []SceneObject{NewSphere(Vector{0, 0, 0}, 1, Material{})}}
+	r := NewRenderer(scene, 1, 1)
+	sampler := NewIndependentSampler(3)
+	sampler.StartSample(0, 0, 0)
+
+	occlusion := func(distance float64, point, normal Vector) float64 {
+		return r.occlusion(sampler, nil, *NewAmbientOcclusion(64, distance), point, normal)
+	}
+	if ao := occlusion(10, Vector{0, 0, 0}, Vector{0, 1, 0}); ao != 0 {
+		t.Errorf("point inside the sphere has ao %v, want 0", ao)
+	}
+	if ao := occlusion(10, Vector{0, 1, 0}, Vector{0, 1, 0}); ao != 1 {
+		t.Errorf("top of a lone sphere has ao %v, want 1", ao)
+	}
+	near := Vector{0, 1.5, 0}
+	down := Vector{0, -1, 0}
+	if ao := occlusion(10, near, down); ao <= 0 || ao >= 1 {
+		t.Errorf("point facing the sphere has ao %v, want partial occlusion", ao)
+	}
+	if ao := occlusion(0.1, near, down); ao != 1 {
+		t.Errorf("sphere beyond the max distance occludes: ao %v", ao)
+	}
+}
+
+// Окклюзия затемняет фоновый свет, и проход ao показывает, где именно
+func TestOcclusionPass(t *testing.T) {
+	const width, height = 48, 24
+
+	render := func(ao *AmbientOcclusion) *Frame {
+		r := NewRenderer(testScene(width, height), width, height)
+		r.SamplesPerPixel = 2
+		r.Sampler = NewIndependentSampler(5)
+		r.Occlusion = ao
+		r.AOVs = []AOV{AOVIndirect, AOVOcclusion}
+		frame, err := r.Render(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return frame
+	}
+
+	flat := render(nil)
+	occluded := render(NewAmbientOcclusion(8, 3))
+
+	pass := occluded.AOV(AOVOcclusion)
+	if slices.Min(pass) < 0 || slices.Max(pass) > 1 || slices.Min(pass) == 1 {
+		t.Fatalf("ao pass range %v..%v, want occlusion under the sphere", slices.Min(pass), slices.Max(pass))
+	}
+	// Без Occlusion проход считается, но фоновый свет не меняет
+	if slices.Min(flat.AOV(AOVOcclusion)) == 1 {
+		t.Error("ao pass is empty without Occlusion")
+	}
+	for i, a := range pass {
+		for c := 3 * i; c < 3*i+3; c++ {
+			want := flat.AOV(AOVIndirect)[c] * a
+			if got := occluded.AOV(AOVIndirect)[c]; abs32(got-want) > 0.05 {
+				t.Fatalf("pixel %d: ambient %g, want flat ambient times ao = %g", i, got, want)
+			}
+		}
+	}
+}
+
+// Когда окружение заменяет постоянный фоновый свет, лучи окклюзии выпускаются только для прохода ao
+func TestOcclusionSkippedWithEnvironment(t *testing.T) {
+	const width, height = 16, 8
+
+	occlusionRays := func(aovs []AOV) int64 {
+		r := NewRenderer(testScene(width, height), width, height)
+		r.SamplesPerPixel = 1
+		r.Sampler = NewIndependentSampler(5)
+		r.EnvironmentSamples = 1
+		r.Occlusion = NewAmbientOcclusion(4, 3)
+		r.AOVs = aovs
+		r.Stats = NewRenderStats()
+		if _, err := r.Render(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		return r.Stats.Report().Rays[RayOcclusion]
+	}
+
+	if n := occlusionRays(nil); n != 0 {
+		t.Errorf("%d occlusion rays cast with environment lighting and no ao pass", n)
+	}
+	if n := occlusionRays([]AOV{AOVOcclusion}); n == 0 {
+		t.Error("ao pass requested but no occlusion rays cast")
+	}
+}
@@ -0,0 +1,79 @@
+package tracer
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// WritePFM записывает изображение в формате Portable Float Map: 32-битные RGB,
+// little-endian, строки снизу вверх
+func WritePFM(w io.Writer, width, height int, rgb []float32) error {
+	if len(rgb) != 3*width*height {
+		return fmt.Errorf("pfm: expected %d values, got %d", 3*width*height, len(rgb))
+	}
+
+	out := bufio.NewWriter(w)
+	// Отрицательный масштаб означает little-endian
+	fmt.Fprintf(out, "PF\n%d %d\n-1.0\n", width, height)
+
+	row := make([]byte, 4*3*width)
+	for y := height - 1; y >= 0; y-- {
+		for i, v := range rgb[3*y*width : 3*(y+1)*width] {
+			binary.LittleEndian.PutUint32(row[4*i:], math.Float32bits(v))
+		}
+		if _, err := out.Write(row); err != nil {
+			return err
+		}
+	}
+	return out.Flush()
+}
+
+// HDRExtensions - расширения файлов, в которые сохраняется линейная яркость кадра
+var HDRExtensions = []string{".exr", ".hdr", ".pfm"}
+
+// SaveFrame сохраняет кадр в формате по расширению файла: .exr, .hdr и .pfm получают
+// линейную яркость, остальные - 8-битное изображение в PNG
+func SaveFrame(filename string, frame *Frame, exr EXROptions) error {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if !slices.Contains(HDRExtensions, ext) {
+		return SavePNG(filename, frame.Image)
+	}
+	return saveRadiance(filename, frame.Width, frame.Height, frame.Radiance, exr)
+}
+
+// saveRadiance сохраняет линейный RGB буфер в формате по расширению: .exr, .hdr или .pfm
+func saveRadiance(filename string, width, height int, rgb []float32, exr EXROptions) error {
+	return writeFile(filename, func(w io.Writer) error {
+		switch ext := strings.ToLower(filepath.Ext(filename)); ext {
+		case ".exr":
+			return WriteEXR(w, width, height, RGBChannels("", rgb), exr)
+		case ".hdr":
+			return WriteHDR(w, width, height, rgb)
+		case ".pfm":
+			return WritePFM(w, width, height, rgb)
+		default:
+			return fmt.Errorf("unsupported HDR format %q", ext)
+		}
+	})
+}
+
+// writeFile создаёт файл и записывает его содержимое функцией encode
+func writeFile(filename string, encode func(w io.Writer) error) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", filename, err)
+	}
+	defer file.Close()
+
+	if err := encode(file); err != nil {
+		return fmt.Errorf("failed to encode %s: %w", filename, err)
+	}
+	return file.Close()
+}
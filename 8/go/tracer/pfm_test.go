@@ -0,0 +1,58 @@
+package tracer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strconv"
+	"testing"
+)
+
+// Кадр читается обратно: масштаб отрицательный (little-endian), строки идут снизу вверх
+func TestWritePFM(t *testing.T) {
+	const width, height = 2, 3
+	rgb := make([]float32, 3*width*height)
+	for i := range rgb {
+		rgb[i] = float32(i) + 0.25
+	}
+
+	var buf bytes.Buffer
+	if err := WritePFM(&buf, width, height, rgb); err != nil {
+		t.Fatal(err)
+	}
+
+	in := bufio.NewReader(&buf)
+	header := make([]string, 3)
+	for i := range header {
+		line, err := in.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		header[i] = line[:len(line)-1]
+	}
+	if header[0] != "PF" || header[1] != "2 3" {
+		t.Fatalf("header %q, want PF and size 2 3", header)
+	}
+	scale, err := strconv.ParseFloat(header[2], 64)
+	if err != nil || scale >= 0 {
+		t.Fatalf("scale %q, want a negative number for little-endian", header[2])
+	}
+
+	data := make([]float32, len(rgb))
+	if err := binary.Read(in, binary.LittleEndian, data); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := in.ReadByte(); err == nil {
+		t.Fatal("data after the last row")
+	}
+	for row := 0; row < height; row++ {
+		y := height - 1 - row
+		for i := 0; i < 3*width; i++ {
+			got, want := data[3*width*row+i], rgb[3*width*y+i]
+			if math.Float32bits(got) != math.Float32bits(want) {
+				t.Fatalf("file row %d value %d is %g, want %g from image row %d", row, i, got, want, y)
+			}
+		}
+	}
+}
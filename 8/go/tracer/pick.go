@@ -0,0 +1,85 @@
+package tracer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Pick - объект под точкой экрана и параметры попадания в него
+type Pick struct {
+	Object   SceneObject
+	ID       int      // Номер объекта, как в Scene.ObjectID и проходе objectid
+	Point    Vector   // Точка попадания
+	Normal   Vector   // Нормаль в точке попадания
+	Distance float64  // Расстояние от центра линзы
+	Material Material // Материал в точке попадания
+}
+
+// Pick находит объект в точке экрана xy лучом из центра линзы, без разброса по диафрагме.
+// Если луч уходит в окружение, возвращает false.
+func (s *Scene) Pick(xy Vector) (Pick, bool) {
+	pinhole := s.Camera
+	pinhole.Aperture = 0
+	ray := pinhole.GenerateRay(xy, 0.5, 0.5)
+
+	hit, obj, found := ray.Cast(s.Objects)
+	if !found {
+		return Pick{}, false
+	}
+	return Pick{
+		Object:   obj,
+		ID:       s.ObjectID(obj),
+		Point:    hit.Point,
+		Normal:   obj.GetNormal(hit.Point),
+		Distance: hit.Distance,
+		Material: obj.GetMaterial(hit.Point),
+	}, true
+}
+
+// Describe возвращает описание попадания для инспектора: тип и размеры объекта,
+// материал, точку, нормаль и расстояние - по строке на параметр
+func (p Pick) Describe() string {
+	lines := []string{fmt.Sprintf("Object #%d: %s", p.ID, describeObject(p.Object))}
+	lines = append(lines,
+		"Diffuse:      "+formatVector(p.Material.DiffuseColor),
+		"Specular:     "+formatVector(p.Material.SpecularColor),
+		"Ambient:      "+formatVector(p.Material.AmbientColor),
+		fmt.Sprintf("Shininess:    %.2f", p.Material.Shininess),
+		fmt.Sprintf("Reflectivity: %.2f", p.Material.Reflectivity),
+		"Hit point:    "+formatVector(p.Point),
+		"Normal:       "+formatVector(p.Normal),
+		fmt.Sprintf("Distance:     %.3f", p.Distance),
+	)
+	return strings.Join(lines, "\n")
+}
+
+// describeObject возвращает тип объекта с его положением и размерами.
+// Тип называется так же, как в статистике рендера.
+func describeObject(obj SceneObject) string {
+	lines := []string{objectKind(obj)}
+	switch o := obj.(type) {
+	case *Sphere:
+		lines = append(lines, "Center:       "+formatVector(o.Center), fmt.Sprintf("Radius:       %.2f", o.Radius))
+	case *Cube:
+		lines = append(lines, "Center:       "+formatVector(o.Center), fmt.Sprintf("Size:         %.2f", o.Size))
+	case *Torus:
+		lines = append(lines, "Center:       "+formatVector(Vector{}), fmt.Sprintf("Radii:        %.2f, %.2f", o.MajorRadius, o.MinorRadius))
+	case *Tetrahedron:
+		var center Vector
+		for _, v := range o.Vertices {
+			center = center.Add(v.Mul(0.25))
+		}
+		lines = append(lines, "Center:       "+formatVector(center))
+		for i, v := range o.Vertices {
+			lines = append(lines, fmt.Sprintf("Vertex %d:     %s", i, formatVector(v)))
+		}
+	case *InfinityChessBoard:
+		lines = append(lines, fmt.Sprintf("Plane:        y = %.2f", o.Y))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// formatVector - короткая запись вектора для инспектора
+func formatVector(v Vector) string {
+	return fmt.Sprintf("%.3f, %.3f, %.3f", v.X, v.Y, v.Z)
+}
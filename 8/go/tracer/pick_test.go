@@ -0,0 +1,45 @@
+package tracer
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestPick(t *testing.T) {
+	const width, height = 48, 24
+	scene := testScene(width, height)
+
+	pick, ok := scene.Pick(Vector{width / 2, height/2 - 2, 0})
+	if !ok {
+		t.Fatal("ray missed the sphere")
+	}
+	if pick.Object != scene.Objects[0] || pick.ID != 1 {
+		t.Fatalf("picked object #%d %T, want the sphere #1", pick.ID, pick.Object)
+	}
+	if d := pick.Point.Sub(Vector{0, -1, -5}).Magnitude(); math.Abs(d-2) > 1e-6 {
+		t.Errorf("hit point %v is %.6f from the sphere center, want 2", pick.Point, d)
+	}
+	if got := pick.Point.Sub(scene.Camera.Position).Magnitude(); math.Abs(got-pick.Distance) > 1e-6 {
+		t.Errorf("distance %.6f, want %.6f", pick.Distance, got)
+	}
+	if pick.Normal.Dot(scene.Camera.Position.Sub(pick.Point)) <= 0 {
+		t.Errorf("normal %v faces away from the camera", pick.Normal)
+	}
+
+	description := pick.Describe()
+	for _, want := range []string{"Object #1: Sphere", "Radius:       2.00", "Shininess:    32.00", "Distance:"} {
+		if !strings.Contains(description, want) {
+			t.Errorf("description lacks %q:\n%s", want, description)
+		}
+	}
+
+	tetrahedron := NewTetrahedron(Vector{0, 0, 0}, Vector{4, 0, 0}, Vector{0, 4, 0}, Vector{0, 0, 4}, Material{})
+	if got := describeObject(tetrahedron); !strings.Contains(got, "Center:       1.000, 1.000, 1.000") || !strings.Contains(got, "Vertex 3:     0.000, 0.000, 4.000") {
+		t.Errorf("tetrahedron description:\n%s", got)
+	}
+
+	if _, ok := scene.Pick(Vector{width / 2, 0, 0}); ok {
+		t.Error("sky pixel picked an object")
+	}
+}
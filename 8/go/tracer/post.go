@@ -0,0 +1,357 @@
+package tracer
+
+import (
+	"image/color"
+	"math"
+)
+
+// PostStack - постобработка кадра после трассировки. Эффекты применяются в порядке полей:
+// хроматическая аберрация, свечение и виньетка - к линейной яркости, затем тональная компрессия,
+// цветокоррекция, LUT и зерно - к значениям sRGB в [0, 1]. nil отключает эффект.
+type PostStack struct {
+	ChromaticAberration *ChromaticAberration `json:"chromaticAberration,omitempty"`
+	Bloom               *Bloom               `json:"bloom,omitempty"`
+	Vignette            *Vignette            `json:"vignette,omitempty"`
+	Grade               *ColorGrade          `json:"grade,omitempty"`
+	LUT                 *LUT                 `json:"lut,omitempty"`
+	Grain               *Grain               `json:"grain,omitempty"`
+}
+
+// Empty сообщает, что ни один эффект не включён
+func (p *PostStack) Empty() bool {
+	return p == nil || *p == PostStack{}
+}
+
+// Apply возвращает копию кадра после постобработки. Radiance копии содержит линейную яркость
+// после эффектов линзы, Image - итоговое изображение со всеми эффектами.
+func (p *PostStack) Apply(src *Frame, tm ToneMapper) *Frame {
+	dst := src.Clone()
+	if p.Empty() {
+		return dst
+	}
+
+	width, height := dst.Width, dst.Height
+	if p.ChromaticAberration != nil {
+		dst.Radiance = p.ChromaticAberration.apply(width, height, dst.Radiance)
+	}
+	if p.Bloom != nil {
+		p.Bloom.apply(width, height, dst.Radiance)
+	}
+	if p.Vignette != nil {
+		p.Vignette.apply(width, height, dst.Radiance)
+	}
+
+	parallelRows(height, func(y int) {
+		for x := 0; x < width; x++ {
+			c := tm.Map(dst.RadianceAt(x, y))
+			c = Vector{linearToSRGB(c.X), linearToSRGB(c.Y), linearToSRGB(c.Z)}
+			if p.Grade != nil {
+				c = p.Grade.apply(c)
+			}
+			if p.LUT != nil {
+				c = p.LUT.apply(c)
+			}
+			if p.Grain != nil {
+				c = p.Grain.apply(x, y, c)
+			}
+			dst.Image.SetRGBA(x, y, color.RGBA{
+				R: uint8(math.Round(saturate(c.X) * 255)),
+				G: uint8(math.Round(saturate(c.Y) * 255)),
+				B: uint8(math.Round(saturate(c.Z) * 255)),
+				A: 255,
+			})
+		}
+	})
+	return dst
+}
+
+// Bloom - свечение ярких областей: яркость выше порога размывается гауссианами
+// на нескольких уровнях пирамиды и добавляется к кадру
+type Bloom struct {
+	Threshold float64 `json:"threshold"` // Яркость, выше которой пиксель светится
+	Intensity float64 `json:"intensity"` // Доля добавляемого свечения
+	Radius    float64 `json:"radius"`    // σ гауссианы самого узкого уровня в пикселях
+	Levels    int     `json:"levels"`    // Уровней пирамиды, каждый вдвое шире предыдущего
+}
+
+// NewBloom создаёт свечение с настройками по умолчанию
+func NewBloom() *Bloom {
+	return &Bloom{Threshold: 1, Intensity: 0.1, Radius: 2, Levels: 5}
+}
+
+// UnmarshalJSON разбирает настройки поверх значений по умолчанию, как и у остальных эффектов
+func (b *Bloom) UnmarshalJSON(data []byte) error {
+	type plain Bloom
+	v := plain(*NewBloom())
+	if err := unmarshalStrict(data, &v); err != nil {
+		return err
+	}
+	*b = Bloom(v)
+	return nil
+}
+
+func (b *Bloom) apply(width, height int, rgb []float32) {
+	// Мягкий порог по яркости сохраняет оттенок пикселя
+	bright := make([]float32, len(rgb))
+	for i := 0; i < width*height; i++ {
+		c := Vector{float64(rgb[3*i]), float64(rgb[3*i+1]), float64(rgb[3*i+2])}
+		l := c.Luminance()
+		if l <= b.Threshold {
+			continue
+		}
+		k := float32((l - b.Threshold) / l)
+		bright[3*i], bright[3*i+1], bright[3*i+2] = rgb[3*i]*k, rgb[3*i+1]*k, rgb[3*i+2]*k
+	}
+
+	glow := make([]float32, len(rgb))
+	level, lw, lh := bright, width, height
+	levels := max(1, b.Levels)
+	for k := 0; k < levels; k++ {
+		if k > 0 {
+			if lw == 1 && lh == 1 {
+				break
+			}
+			level, lw, lh = downsample(level, lw, lh)
+		}
+		blurred := gaussianBlur(level, lw, lh, b.Radius)
+		upsampleAdd(glow, width, height, blurred, lw, lh)
+	}
+
+	scale := float32(b.Intensity / float64(levels))
+	for i := range rgb {
+		rgb[i] += glow[i] * scale
+	}
+}
+
+// gaussianBlur размывает RGB буфер разделимой гауссианой, за краем повторяются крайние пиксели
+func gaussianBlur(rgb []float32, width, height int, sigma float64) []float32 {
+	radius := int(math.Ceil(3 * sigma))
+	kernel := make([]float64, 2*radius+1)
+	sum := 0.0
+	for i := range kernel {
+		d := float64(i - radius)
+		kernel[i] = math.Exp(-d * d / (2 * sigma * sigma))
+		sum += kernel[i]
+	}
+	for i := range kernel {
+		kernel[i] /= sum
+	}
+
+	pass := func(src []float32, horizontal bool) []float32 {
+		dst := make([]float32, len(src))
+		parallelRows(height, func(y int) {
+			for x := 0; x < width; x++ {
+				var r, g, b float64
+				for k, w := range kernel {
+					sx, sy := x, y
+					if horizontal {
+						sx = clamp(x+k-radius, 0, width-1)
+					} else {
+						sy = clamp(y+k-radius, 0, height-1)
+					}
+					i := 3 * (sy*width + sx)
+					r += w * float64(src[i])
+					g += w * float64(src[i+1])
+					b += w * float64(src[i+2])
+				}
+				i := 3 * (y*width + x)
+				dst[i], dst[i+1], dst[i+2] = float32(r), float32(g), float32(b)
+			}
+		})
+		return dst
+	}
+	return pass(pass(rgb, true), false)
+}
+
+// downsample уменьшает RGB буфер вдвое усреднением блоков 2x2
+func downsample(rgb []float32, width, height int) ([]float32, int, int) {
+	w, h := max(1, (width+1)/2), max(1, (height+1)/2)
+	dst := make([]float32, 3*w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			for c := 0; c < 3; c++ {
+				var sum float32
+				for _, d := range [4][2]int{{0, 0}, {1, 0}, {0, 1}, {1, 1}} {
+					sx, sy := min(2*x+d[0], width-1), min(2*y+d[1], height-1)
+					sum += rgb[3*(sy*width+sx)+c]
+				}
+				dst[3*(y*w+x)+c] = sum / 4
+			}
+		}
+	}
+	return dst, w, h
+}
+
+// upsampleAdd добавляет к dst буфер src меньшего размера с билинейной интерполяцией
+func upsampleAdd(dst []float32, width, height int, src []float32, w, h int) {
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := sampleBilinear(src, w, h, (float64(x)+0.5)*float64(w)/float64(width), (float64(y)+0.5)*float64(h)/float64(height))
+			i := 3 * (y*width + x)
+			dst[i] += float32(c.X)
+			dst[i+1] += float32(c.Y)
+			dst[i+2] += float32(c.Z)
+		}
+	}
+}
+
+// sampleBilinear возвращает цвет RGB буфера в точке (fx, fy), заданной в пикселях от левого верхнего угла
+func sampleBilinear(rgb []float32, width, height int, fx, fy float64) Vector {
+	fx -= 0.5
+	fy -= 0.5
+	x0, y0 := int(math.Floor(fx)), int(math.Floor(fy))
+	tx, ty := fx-float64(x0), fy-float64(y0)
+
+	at := func(x, y int) Vector {
+		i := 3 * (clamp(y, 0, height-1)*width + clamp(x, 0, width-1))
+		return Vector{float64(rgb[i]), float64(rgb[i+1]), float64(rgb[i+2])}
+	}
+	top := at(x0, y0).Mul(1 - tx).Add(at(x0+1, y0).Mul(tx))
+	bottom := at(x0, y0+1).Mul(1 - tx).Add(at(x0+1, y0+1).Mul(tx))
+	return top.Mul(1 - ty).Add(bottom.Mul(ty))
+}
+
+// ChromaticAberration - поперечная хроматическая аберрация: красный канал
+// растянут от центра кадра, синий сжат
+type ChromaticAberration struct {
+	Amount float64 `json:"amount"` // Относительное смещение каналов на краю кадра
+}
+
+// NewChromaticAberration создаёт аберрацию с настройками по умолчанию
+func NewChromaticAberration() *ChromaticAberration {
+	return &ChromaticAberration{Amount: 0.003}
+}
+
+func (a *ChromaticAberration) UnmarshalJSON(data []byte) error {
+	type plain ChromaticAberration
+	v := plain(*NewChromaticAberration())
+	if err := unmarshalStrict(data, &v); err != nil {
+		return err
+	}
+	*a = ChromaticAberration(v)
+	return nil
+}
+
+func (a *ChromaticAberration) apply(width, height int, rgb []float32) []float32 {
+	dst := make([]float32, len(rgb))
+	cx, cy := float64(width)/2, float64(height)/2
+	parallelRows(height, func(y int) {
+		for x := 0; x < width; x++ {
+			dx, dy := float64(x)+0.5-cx, float64(y)+0.5-cy
+			i := 3 * (y*width + x)
+			dst[i] = float32(sampleBilinear(rgb, width, height, cx+dx*(1-a.Amount), cy+dy*(1-a.Amount)).X)
+			dst[i+1] = rgb[i+1]
+			dst[i+2] = float32(sampleBilinear(rgb, width, height, cx+dx*(1+a.Amount), cy+dy*(1+a.Amount)).Z)
+		}
+	})
+	return dst
+}
+
+// Vignette - естественное затемнение к краям кадра по закону cos⁴
+type Vignette struct {
+	Strength float64 `json:"strength"` // Тангенс угла луча в углу кадра, 0 - без затемнения
+}
+
+// NewVignette создаёт виньетку с настройками по умолчанию
+func NewVignette() *Vignette {
+	return &Vignette{Strength: 0.5}
+}
+
+func (v *Vignette) UnmarshalJSON(data []byte) error {
+	type plain Vignette
+	p := plain(*NewVignette())
+	if err := unmarshalStrict(data, &p); err != nil {
+		return err
+	}
+	*v = Vignette(p)
+	return nil
+}
+
+func (v *Vignette) apply(width, height int, rgb []float32) {
+	cx, cy := float64(width)/2, float64(height)/2
+	corner := math.Hypot(cx, cy)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			t := v.Strength * math.Hypot(float64(x)+0.5-cx, float64(y)+0.5-cy) / corner
+			// cos⁴θ = 1 / (1 + tg²θ)²
+			k := float32(1 / ((1 + t*t) * (1 + t*t)))
+			i := 3 * (y*width + x)
+			rgb[i] *= k
+			rgb[i+1] *= k
+			rgb[i+2] *= k
+		}
+	}
+}
+
+// ColorGrade - цветокоррекция lift/gamma/gain по каналам RGB:
+// out = (gain · (v + lift · (1 - v)))^(1/gamma)
+type ColorGrade struct {
+	Lift  [3]float64 `json:"lift"`  // Подъём теней
+	Gamma [3]float64 `json:"gamma"` // Гамма средних тонов
+	Gain  [3]float64 `json:"gain"`  // Усиление светов
+}
+
+// NewColorGrade создаёт нейтральную цветокоррекцию
+func NewColorGrade() *ColorGrade {
+	return &ColorGrade{Gamma: [3]float64{1, 1, 1}, Gain: [3]float64{1, 1, 1}}
+}
+
+func (g *ColorGrade) UnmarshalJSON(data []byte) error {
+	type plain ColorGrade
+	v := plain(*NewColorGrade())
+	if err := unmarshalStrict(data, &v); err != nil {
+		return err
+	}
+	*g = ColorGrade(v)
+	return nil
+}
+
+func (g *ColorGrade) apply(c Vector) Vector {
+	channel := func(v float64, i int) float64 {
+		v = g.Gain[i] * (v + g.Lift[i]*(1-v))
+		return math.Pow(math.Max(0, v), 1/g.Gamma[i])
+	}
+	return Vector{channel(c.X, 0), channel(c.Y, 1), channel(c.Z, 2)}
+}
+
+// Grain - монохромное плёночное зерно, сильнее всего заметное в средних тонах.
+// Шум зависит только от координат пикселя и Seed, поэтому одинаков в окне и при сохранении.
+type Grain struct {
+	Intensity float64 `json:"intensity"` // Амплитуда шума в средних тонах
+	Size      float64 `json:"size"`      // Размер зерна в пикселях
+	Seed      int     `json:"seed"`
+}
+
+// NewGrain создаёт зерно с настройками по умолчанию
+func NewGrain() *Grain {
+	return &Grain{Intensity: 0.04, Size: 1}
+}
+
+func (g *Grain) UnmarshalJSON(data []byte) error {
+	type plain Grain
+	v := plain(*NewGrain())
+	if err := unmarshalStrict(data, &v); err != nil {
+		return err
+	}
+	*g = Grain(v)
+	return nil
+}
+
+// noise возвращает значение шума в [-1, 1] узла решётки зерна
+func (g *Grain) noise(x, y int) float64 {
+	return float64(hashUint32(uint32(x), uint32(y), uint32(g.Seed)))/float64(math.MaxUint32)*2 - 1
+}
+
+func (g *Grain) apply(x, y int, c Vector) Vector {
+	// Билинейная интерполяция шума решётки с шагом Size
+	size := math.Max(g.Size, 1e-3)
+	fx, fy := float64(x)/size, float64(y)/size
+	x0, y0 := int(math.Floor(fx)), int(math.Floor(fy))
+	tx, ty := fx-float64(x0), fy-float64(y0)
+	top := g.noise(x0, y0)*(1-tx) + g.noise(x0+1, y0)*tx
+	bottom := g.noise(x0, y0+1)*(1-tx) + g.noise(x0+1, y0+1)*tx
+	n := top*(1-ty) + bottom*ty
+
+	l := saturate(c.Luminance())
+	return c.Add(n * g.Intensity * 4 * l * (1 - l))
+}
@@ -0,0 +1,100 @@
+package tracer
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Файл сцены подставляет значения по умолчанию и загружает LUT рядом с собой
+func TestSceneFilePost(t *testing.T) {
+	dir := t.TempDir()
+
+	// Инвертирующая таблица 2x2x2
+	var cube strings.Builder
+	cube.WriteString("# invert\nTITLE \"invert\"\nLUT_3D_SIZE 2\n")
+	for b := 0; b < 2; b++ {
+		for g := 0; g < 2; g++ {
+			for r := 0; r < 2; r++ {
+				fmt.Fprintf(&cube, "%d %d %d\n", 1-r, 1-g, 1-b)
+			}
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "invert.cube"), []byte(cube.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	scenePath := filepath.Join(dir, "scene.json")
+	config := `{"post": {"bloom": {"threshold": 2}, "lut": {"path": "invert.cube"}}}`
+	if err := os.WriteFile(scenePath, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	scene, err := LoadSceneFile(scenePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	post := scene.Post
+	if post.Bloom.Threshold != 2 || post.Bloom.Intensity != NewBloom().Intensity {
+		t.Errorf("bloom %+v, want threshold 2 and default intensity", *post.Bloom)
+	}
+	if post.Vignette != nil || post.Grain != nil {
+		t.Errorf("effects missing from the file must stay disabled")
+	}
+	if got := post.LUT.apply(Vector{0.25, 0.5, 0.75}); got.Sub(Vector{0.75, 0.5, 0.25}).Magnitude() > 1e-6 {
+		t.Errorf("inverting LUT maps (0.25, 0.5, 0.75) to %v", got)
+	}
+
+	if _, err := ReadCubeLUT(strings.NewReader("LUT_3D_SIZE 2\n0 0 0\n")); err == nil {
+		t.Errorf("truncated cube file parsed without error")
+	}
+	if _, err := LoadSceneFile(writeTemp(t, dir, `{"post": {"blum": {}}}`)); err == nil {
+		t.Errorf("unknown effect parsed without error")
+	}
+}
+
+func writeTemp(t *testing.T, dir, content string) string {
+	path := filepath.Join(dir, "bad.json")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// Свечение сохраняет энергию яркости выше порога, виньетка затемняет углы,
+// а пустой стек не меняет изображение
+func TestPostStack(t *testing.T) {
+	const size = 65
+	rgb := make([]float32, 3*size*size)
+	for i := range rgb {
+		rgb[i] = 0.2
+	}
+	center := 3 * (size/2*size + size/2)
+	rgb[center], rgb[center+1], rgb[center+2] = 50, 50, 50
+	frame := NewFrameFromRadiance(size, size, rgb, NewToneMapper())
+
+	if empty := (&PostStack{}).Apply(frame, NewToneMapper()); !bytes.Equal(empty.Image.Pix, frame.Image.Pix) {
+		t.Errorf("empty post stack changed the image")
+	}
+
+	bloom := NewBloom()
+	bloom.Levels = 3
+	glowing := (&PostStack{Bloom: bloom}).Apply(frame, NewToneMapper())
+	var added float64
+	for i := 0; i < size*size; i++ {
+		added += float64(glowing.Radiance[3*i] - frame.Radiance[3*i])
+	}
+	if want := bloom.Intensity * (50 - bloom.Threshold); added < 0.95*want || added > 1.05*want {
+		t.Errorf("bloom added %g, want about %g", added, want)
+	}
+	if glowing.Radiance[center+3] <= frame.Radiance[center+3] {
+		t.Errorf("bloom did not spread to the neighbouring pixel")
+	}
+
+	vignetted := (&PostStack{Vignette: NewVignette()}).Apply(frame, NewToneMapper())
+	if corner := vignetted.RadianceAt(0, 0); corner.X >= 0.2*0.9 {
+		t.Errorf("vignette left the corner at %v", corner)
+	}
+}
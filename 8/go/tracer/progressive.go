@@ -0,0 +1,191 @@
+package tracer
+
+import (
+	"context"
+	"image"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Progressive добавляет по одному сэмплу на пиксель за проход,
+// так что изображение постепенно сходится к итоговому.
+// При включённом адаптивном сэмплировании сошедшиеся пиксели пропускаются.
+type Progressive struct {
+	Renderer      *Renderer
+	TargetSamples int // Количество проходов, после которого рендер останавливается (0 - без ограничения)
+
+	mu     sync.Mutex
+	parent context.Context // Контекст, с которым запущено накопление
+	camera Camera          // Камера, с которой начато накопление
+	stats  []pixelStats    // Накопленные сэмплы по пикселям
+	film   *film           // Взвешенные суммы сэмплов для фильтра восстановления
+	frame  *Frame          // Текущее усреднённое изображение
+	passes atomic.Int64
+	active atomic.Int64 // Пикселей, получивших сэмпл за последний проход
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewProgressive создаёт прогрессивный рендер поверх renderer
+func NewProgressive(renderer *Renderer, targetSamples int) *Progressive {
+	size := renderer.Width * renderer.Height
+	frame := NewFrame(renderer.Width, renderer.Height)
+	frame.EnableAOVs(renderer.AOVs)
+	return &Progressive{
+		Renderer:      renderer,
+		TargetSamples: targetSamples,
+		stats:         make([]pixelStats, size),
+		film:          newFilm(renderer.Width, renderer.Height, renderer.Filter, renderer.ToneMapper),
+		frame:         frame,
+	}
+}
+
+// Start запускает накопление в фоне, если оно ещё не идёт
+func (p *Progressive) Start(ctx context.Context) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.done != nil {
+		return
+	}
+
+	p.parent = ctx
+	ctx, p.cancel = context.WithCancel(ctx)
+	p.done = make(chan struct{})
+	p.camera = p.Renderer.Scene.Camera
+	go p.run(ctx, p.done)
+}
+
+// Stop прерывает накопление и ждёт остановки рабочих. Накопленные сэмплы сохраняются.
+func (p *Progressive) Stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stopLocked()
+}
+
+func (p *Progressive) stopLocked() {
+	if p.done == nil {
+		return
+	}
+	p.cancel()
+	<-p.done
+	p.done = nil
+}
+
+// Reset сбрасывает буфер накопления и начинает рендер заново
+func (p *Progressive) Reset() {
+	p.mu.Lock()
+	p.stopLocked()
+	clear(p.stats)
+	p.film = newFilm(p.Renderer.Width, p.Renderer.Height, p.Renderer.Filter, p.Renderer.ToneMapper)
+	p.frame.Clear()
+	p.Renderer.Stats.Reset()
+	p.passes.Store(0)
+	p.active.Store(0)
+	parent := p.parent
+	p.mu.Unlock()
+
+	if parent == nil {
+		parent = context.Background()
+	}
+	p.Start(parent)
+}
+
+// SetScene подменяет сцену. Если сцена или параметры камеры изменились, накопление начинается заново.
+func (p *Progressive) SetScene(scene *Scene) {
+	p.mu.Lock()
+	changed := scene != p.Renderer.Scene || scene.Camera != p.camera
+	if changed {
+		p.stopLocked()
+		p.Renderer.Scene = scene
+	}
+	p.mu.Unlock()
+
+	if changed {
+		p.Reset()
+	}
+}
+
+// SetToneMapper меняет тональную компрессию и перестраивает изображение без перерендера.
+// Рабочие не останавливаются: компрессия меняется под мьютексом слияния тайлов.
+func (p *Progressive) SetToneMapper(tm ToneMapper) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Renderer.ToneMapper = tm
+	p.film.setToneMapper(tm, p.frame)
+}
+
+// Image возвращает текущее усреднённое изображение. Оно обновляется по мере готовности тайлов.
+func (p *Progressive) Image() *image.RGBA {
+	return p.frame.Image
+}
+
+// Frame возвращает текущий кадр вместе с HDR яркостью и количеством сэмплов по пикселям
+func (p *Progressive) Frame() *Frame {
+	return p.frame
+}
+
+// Passes возвращает количество завершённых проходов
+func (p *Progressive) Passes() int {
+	return int(p.passes.Load())
+}
+
+// Converged сообщает, набрано ли целевое количество сэмплов
+// или все пиксели сошлись при адаптивном сэмплировании
+func (p *Progressive) Converged() bool {
+	if p.TargetSamples > 0 && p.Passes() >= p.TargetSamples {
+		return true
+	}
+	return p.Renderer.Adaptive != nil && p.Passes() > 0 && p.active.Load() == 0
+}
+
+func (p *Progressive) run(ctx context.Context, done chan struct{}) {
+	defer close(done)
+
+	r := p.Renderer
+	for !p.Converged() {
+		var active atomic.Int64
+		err := r.Scheduler.Run(ctx, r.Width, r.Height, func(ctx context.Context, tile image.Rectangle) {
+			active.Add(int64(p.renderTile(ctx, tile)))
+		})
+		if err != nil {
+			return
+		}
+		p.active.Store(active.Load())
+		p.passes.Add(1)
+	}
+}
+
+// renderTile добавляет по сэмплу в каждый несошедшийся пиксель тайла и обновляет изображение.
+// Возвращает количество пикселей, получивших сэмпл.
+func (p *Progressive) renderTile(ctx context.Context, tile image.Rectangle) int {
+	r := p.Renderer
+	start := time.Now()
+	sampler := r.Sampler.Clone()
+	counters := r.Stats.counters(r.Scene)
+	buffer := p.film.tile(tile)
+	defer p.film.merge(buffer, p.frame)
+	defer r.Stats.addTile(r.Scene, tile, start, counters)
+
+	active := 0
+	for y := tile.Min.Y; y < tile.Max.Y; y++ {
+		if ctx.Err() != nil {
+			return active
+		}
+		for x := tile.Min.X; x < tile.Max.X; x++ {
+			i := y*r.Width + x
+			stats := &p.stats[i]
+			if r.Adaptive != nil && r.Adaptive.done(stats) {
+				continue
+			}
+
+			c, features, offset := r.renderSample(sampler, counters, x, y, stats.n)
+			stats.add(c, features)
+			buffer.add(x, y, offset, c)
+			p.frame.Samples[i] = stats.n
+			p.frame.SetFeatures(x, y, stats.averageFeatures(), stats.meanVariance())
+			active++
+		}
+	}
+	return active
+}
@@ -0,0 +1,45 @@
+package tracer
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// Смена тональной компрессии после первого прохода не добавляет и не теряет сэмплы,
+// и изображение собирается с новой компрессией
+func TestProgressiveSetToneMapper(t *testing.T) {
+	const width, height, samples = 40, 20, 8
+
+	r := NewRenderer(testScene(width, height), width, height)
+	r.Sampler = NewIndependentSampler(3)
+	r.Scheduler = Scheduler{TileSize: 8, Order: TileOrderScanline, Workers: 2}
+	progressive := NewProgressive(r, samples)
+	progressive.Start(context.Background())
+	for progressive.Passes() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	tm := NewToneMapper()
+	tm.Operator = ToneReinhard
+	tm.Exposure = 1
+	progressive.SetToneMapper(tm)
+	for !progressive.Converged() {
+		time.Sleep(time.Millisecond)
+	}
+	progressive.Stop()
+
+	frame := progressive.Frame()
+	for i, n := range frame.Samples {
+		if n != samples {
+			t.Fatalf("pixel %d has %d samples, want %d", i, n, samples)
+		}
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if got, want := frame.Image.RGBAAt(x, y), tm.Encode(frame.RadianceAt(x, y)); got != want {
+				t.Fatalf("pixel %d,%d is %v, want %v after the tone mapper change", x, y, got, want)
+			}
+		}
+	}
+}
@@ -1,4 +1,4 @@
-package main
+package tracer
 
 import (
 	"math"
@@ -17,11 +17,17 @@ func NewRay(origin, direction Vector) Ray {
 }
 
 func (r Ray) Cast(objects []SceneObject) (IntersectionResult, SceneObject, bool) {
+	return r.cast(objects, nil)
+}
+
+// cast ищет ближайшее пересечение, учитывая проверки с каждым объектом в counters
+func (r Ray) cast(objects []SceneObject, counters *rayCounters) (IntersectionResult, SceneObject, bool) {
 	closestIntersection := IntersectionResult{Distance: math.MaxFloat64}
 	var closestObject SceneObject
 	found := false
 
-	for _, obj := range objects {
+	for i, obj := range objects {
+		counters.test(i)
 		if intersection, hit := obj.Intersection(r); hit {
 			if intersection.Distance < closestIntersection.Distance && intersection.Distance > 0 {
 				closestIntersection = intersection
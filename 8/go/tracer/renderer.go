@@ -0,0 +1,407 @@
+package tracer
+
+import (
+	"context"
+	"image"
+	"math"
+	"math/rand"
+	"slices"
+	"time"
+)
+
+const (
+	shadowBias = 0.0001 // Смещение для избежания самозатенения
+
+	DefaultSamplesPerPixel = 3 // Сэмплов на пиксель (для антиалиасинга)
+	DefaultMaxReflections  = 4 // Максимальное количество отражений
+)
+
+// Scene хранит объекты, свет, камеру и окружение
+type Scene struct {
+	Objects []SceneObject    // Объекты сцены
+	Light   DirectionalLight // Источник света
+	Camera  Camera           // Камера
+	Skybox  Environment      // Окружение для лучей без пересечений
+}
+
+// WithCamera возвращает копию сцены с другой камерой.
+// Объекты и окружение общие с исходной сценой.
+func (s *Scene) WithCamera(camera Camera) *Scene {
+	copied := *s
+	copied.Camera = camera
+	return &copied
+}
+
+// FocusAt возвращает копию сцены с камерой, сфокусированной на объекте в точке экрана xy.
+// Расстояние берётся по лучу из центра линзы, как в Pick.
+// Если луч уходит в окружение, возвращает false.
+func (s *Scene) FocusAt(xy Vector) (*Scene, bool) {
+	pick, ok := s.Pick(xy)
+	if !ok {
+		return s, false
+	}
+	camera := s.Camera
+	camera.FocusDistance = pick.Distance
+	return s.WithCamera(camera), true
+}
+
+// Renderer трассирует лучи через сцену и собирает изображение
+type Renderer struct {
+	Scene           *Scene
+	Width, Height   int
+	SamplesPerPixel int
+	MaxReflections  int
+	Scheduler       Scheduler
+	Adaptive        *AdaptiveSampling // Адаптивное сэмплирование, nil - фиксированные SamplesPerPixel
+	Sampler         Sampler           // Прототип сэмплера, каждый тайл рендерится своей копией
+	ToneMapper      ToneMapper        // Перевод HDR яркости в пиксели изображения
+
+	// Направлений на окружение в точке освещения, 0 - окружение видно, но не светит
+	EnvironmentSamples int
+
+	AOVs   []AOV  // Дополнительные проходы, которые собираются в кадр
+	Filter Filter // Фильтр восстановления пикселей по сэмплам
+
+	Stats *RenderStats // Счётчики лучей и время тайлов, nil - не собирать
+
+	Occlusion *AmbientOcclusion // Затенение фоновой составляющей, nil - фоновый свет везде одинаков
+
+	Debug      DebugMode // Отладочное отображение вместо освещения
+	DebugDepth float64   // Расстояние, на котором режим depth даёт серый 50%, 0 - фокусное расстояние камеры
+}
+
+// NewRenderer создаёт рендерер с настройками по умолчанию
+func NewRenderer(scene *Scene, width, height int) *Renderer {
+	return &Renderer{
+		Scene:           scene,
+		Width:           width,
+		Height:          height,
+		SamplesPerPixel: DefaultSamplesPerPixel,
+		MaxReflections:  DefaultMaxReflections,
+		Scheduler:       NewScheduler(32, TileOrderSpiral),
+		Sampler:         NewIndependentSampler(rand.Int63()),
+		ToneMapper:      NewToneMapper(),
+		Filter:          NewFilter(FilterBox, 0),
+	}
+}
+
+// Умножение цветов (покомпонентное)
+func multiplyColors(a, b Vector) Vector {
+	return Vector{a.X * b.X, a.Y * b.Y, a.Z * b.Z}
+}
+
+// Сложение цветов (покомпонентное)
+func addColors(a, b Vector) Vector {
+	return Vector{a.X + b.X, a.Y + b.Y, a.Z + b.Z}
+}
+
+// ObjectID возвращает номер объекта в сцене, начиная с 1; 0 - окружение или неизвестный объект
+func (s *Scene) ObjectID(obj SceneObject) int {
+	return slices.Index(s.Objects, obj) + 1
+}
+
+// shading - составляющие освещения точки, из которых собираются AOV
+type shading struct {
+	direct   Vector  // Диффузный и зеркальный свет источника
+	indirect Vector  // Фоновый свет или освещение окружением
+	shadow   Vector  // Свет источника, перекрытый тенью
+	ao       float64 // Доля незакрытых направлений полусферы, 1 без окклюзии
+}
+
+// rayHit - результат трассировки луча
+type rayHit struct {
+	shading
+	background Vector      // Яркость окружения при промахе
+	point      *Vector     // Точка пересечения, nil при промахе
+	object     SceneObject // Объект пересечения
+	normal     Vector      // Нормаль в точке пересечения
+}
+
+// color возвращает итоговую яркость луча
+func (h rayHit) color() Vector {
+	return h.background.Add(h.direct).Add(h.indirect)
+}
+
+// TraceRay находит ближайшее пересечение луча со сценой и освещает его.
+// Возвращает цвет, точку пересечения (nil при промахе), объект и нормаль.
+// Направления на окружение при освещении берутся из sampler.
+func (r *Renderer) TraceRay(sampler Sampler, ray Ray) (Vector, *Vector, SceneObject, Vector) {
+	hit := r.trace(sampler, nil, ray)
+	return hit.color(), hit.point, hit.object, hit.normal
+}
+
+// trace трассирует луч, сохраняя составляющие освещения по отдельности.
+// Лучи и проверки пересечения учитываются в counters.
+func (r *Renderer) trace(sampler Sampler, counters *rayCounters, ray Ray) rayHit {
+	var hit rayHit
+
+	// Проверка пересечения луча с объектами
+	point, obj, found := ray.cast(r.Scene.Objects, counters)
+	if found {
+		hit.point = &point.Point
+		hit.object = obj
+		hit.normal = obj.GetNormal(point.Point)
+		hit.shading = r.shade(sampler, counters, point.Point, hit.normal, obj.GetMaterial(point.Point))
+	} else if r.Scene.Skybox != nil {
+		// Если нет пересечения - цвет из окружения, без окружения фон чёрный
+		hit.background = r.Scene.Skybox.GetImageCoords(ray.Direction)
+	}
+
+	return hit
+}
+
+// environmentLit сообщает, заменяет ли освещение окружением постоянную фоновую составляющую
+func (r *Renderer) environmentLit() bool {
+	return r.EnvironmentSamples > 0 && r.Scene.Skybox != nil
+}
+
+// shade считает освещение по Фонгу в точке point.
+// Если окружение светит, оно заменяет постоянную фоновую составляющую,
+// иначе фоновая составляющая ослабляется окклюзией r.Occlusion.
+func (r *Renderer) shade(sampler Sampler, counters *rayCounters, point, normal Vector, material Material) shading {
+	light := r.Scene.Light
+	viewDir := r.Scene.Camera.Position.Sub(point).Normalize()
+
+	// Окклюзия считается по стороне поверхности, которую видит камера
+	ao := 1.0
+	if settings, ok := r.occlusionSettings(); ok {
+		facing := normal
+		if facing.Dot(viewDir) < 0 {
+			facing = facing.Neg()
+		}
+		ao = r.occlusion(sampler, counters, settings, point, facing)
+	}
+
+	// Фоновая составляющая. Освещение окружением уже проверено теневыми лучами и окклюзией не ослабляется.
+	var ambient Vector
+	if r.environmentLit() {
+		ambient = r.environmentLight(sampler, counters, point, normal, material)
+	} else {
+		ambient = multiplyColors(material.AmbientColor, light.AmbientColor)
+		if r.Occlusion != nil {
+			ambient = ambient.Mul(ao)
+		}
+	}
+
+	// закон Ламберта
+	lightDir := light.Direction.Neg().Normalize()
+	diffuseIntensity := math.Max(0, normal.Dot(lightDir)) * light.Strength
+	diffuse := multiplyColors(material.DiffuseColor, light.DiffuseColor).Mul(diffuseIntensity)
+
+	// Зеркальная составляющая
+	reflectDir := normal.Mul(2 * normal.Dot(lightDir)).Sub(lightDir)
+	specularIntensity := math.Pow(math.Max(0, viewDir.Dot(reflectDir)), material.Shininess)
+	specular := multiplyColors(material.SpecularColor, light.SpecularColor).Mul(specularIntensity)
+
+	// Проверка нахождения точки в тени: диффузный и зеркальный свет в тени не доходит
+	shadowRay := Ray{Origin: point.Add(lightDir.Mul(0.001)), Direction: lightDir}
+	counters.ray(RayShadow)
+	_, _, shadowHit := shadowRay.cast(r.Scene.Objects, counters)
+
+	result := shading{indirect: ambient, ao: ao}
+	if shadowHit {
+		result.shadow = addColors(diffuse, specular)
+	} else {
+		result.direct = addColors(diffuse, specular)
+	}
+	return result
+}
+
+// environmentLight оценивает диффузное освещение окружением методом Монте-Карло:
+// направления выбираются пропорционально яркости панорамы и проверяются теневым лучом
+func (r *Renderer) environmentLight(sampler Sampler, counters *rayCounters, point, normal Vector, material Material) Vector {
+	sky := r.Scene.Skybox
+	irradiance := Vector{0, 0, 0}
+
+	for i := 0; i < r.EnvironmentSamples; i++ {
+		u1, u2 := sampler.Get2D()
+		direction, radiance, pdf := sky.Sample(u1, u2)
+		cosTheta := normal.Dot(direction)
+		if pdf <= 0 || cosTheta <= 0 {
+			continue
+		}
+
+		shadowRay := Ray{Origin: point.Add(direction.Mul(shadowBias)), Direction: direction}
+		counters.ray(RayShadow)
+		if _, _, hit := shadowRay.cast(r.Scene.Objects, counters); hit {
+			continue
+		}
+
+		// Ламбертов BRDF равен albedo / π
+		irradiance = irradiance.Add(radiance.Mul(cosTheta / (math.Pi * pdf)))
+	}
+
+	return multiplyColors(material.DiffuseColor, irradiance.Div(float64(r.EnvironmentSamples)))
+}
+
+// Preview возвращает копию рендерера для быстрого предпросмотра: разрешение в scale раз меньше,
+// один сэмпл на пиксель, без адаптивного сэмплирования и AOV. Кадрирование камеры не меняется.
+func (r *Renderer) Preview(scale int) *Renderer {
+	preview := *r
+	preview.Width = max(1, r.Width/scale)
+	preview.Height = max(1, r.Height/scale)
+	preview.SamplesPerPixel = 1
+	preview.Adaptive = nil
+	preview.AOVs = nil
+	preview.Stats = nil
+	preview.Filter = NewFilter(FilterBox, 0)
+
+	camera := r.Scene.Camera
+	camera.ScreenSize = Vector{float64(preview.Width), float64(preview.Height), 0}
+	preview.Scene = r.Scene.WithCamera(camera)
+	return &preview
+}
+
+// RenderSample трассирует сэмпл index пикселя (x, y), включая отражения.
+// Смещение внутри пикселя и точка на линзе берутся из sampler.
+// Кроме цвета возвращает признаки первого пересечения для денойзера и AOV
+// и смещение сэмпла от центра пикселя для фильтра восстановления.
+func (r *Renderer) RenderSample(sampler Sampler, x, y, index int) (Vector, Features, Vector) {
+	return r.renderSample(sampler, nil, x, y, index)
+}
+
+// renderSample - RenderSample с учётом лучей в counters
+func (r *Renderer) renderSample(sampler Sampler, counters *rayCounters, x, y, index int) (Vector, Features, Vector) {
+	sampler.StartSample(x, y, index)
+	px, py := sampler.Get2D()
+	offset := Vector{px - 0.5, py - 0.5, 0}
+	jx := float64(x) + offset.X
+	jy := float64(y) + offset.Y
+
+	lensU, lensV := sampler.Get2D()
+	ray := r.Scene.Camera.GenerateRay(Vector{jx, jy, 0}, lensU, lensV)
+	counters.ray(RayPrimary)
+	if r.Debug != DebugOff {
+		// Без освещения и отражений: только первое пересечение
+		color, features := r.debugSample(sampler, counters, ray)
+		return color, features, offset
+	}
+	hit := r.trace(sampler, counters, ray)
+	color := hit.color()
+	features := skyFeatures
+
+	if intersect, normal := hit.point, hit.normal; intersect != nil {
+		features = Features{
+			Albedo:   hit.object.GetMaterial(*intersect).DiffuseColor,
+			Normal:   normal,
+			Depth:    intersect.Sub(ray.Origin).Magnitude(),
+			Object:   r.Scene.ObjectID(hit.object),
+			Direct:   hit.direct,
+			Indirect: hit.indirect,
+			Shadow:   hit.shadow,
+			AO:       hit.ao,
+		}
+
+		// Обработка отражений
+		reflectionDir := ray.Direction.Reflect(normal)
+		reflectionRay := Ray{
+			Origin:    intersect.Add(reflectionDir.Mul(shadowBias)),
+			Direction: reflectionDir,
+		}
+
+		reflectionColor := Vector{0, 0, 0}
+		reflectionTimes := 0
+
+		// Рекурсивная трассировка отражений
+		for i := 0; i < r.MaxReflections; i++ {
+			counters.ray(RayReflection)
+			newHit := r.trace(sampler, counters, reflectionRay)
+			if newIntersect := newHit.point; newIntersect != nil {
+				reflectionColor = reflectionColor.Add(newHit.color())
+				reflectionTimes++
+				newReflectionDir := reflectionRay.Direction.Reflect(newHit.normal)
+				reflectionRay = Ray{
+					Origin:    newIntersect.Add(newReflectionDir.Mul(shadowBias)),
+					Direction: newReflectionDir,
+				}
+			} else {
+				break
+			}
+		}
+
+		if reflectionTimes > 0 {
+			features.Reflection = reflectionColor.Div(float64(reflectionTimes))
+			color = color.Add(features.Reflection)
+		}
+	}
+
+	return color, features, offset
+}
+
+// RenderPixel рендерит один пиксель с антиалиасингом
+func (r *Renderer) RenderPixel(sampler Sampler, x, y int) Vector {
+	c, _ := r.SamplePixel(sampler, x, y)
+	return c
+}
+
+// SamplePixel рендерит пиксель и возвращает его цвет и количество потраченных сэмплов.
+// Без адаптивного сэмплирования усредняются SamplesPerPixel сэмплов; фильтр восстановления не применяется.
+func (r *Renderer) SamplePixel(sampler Sampler, x, y int) (Vector, int) {
+	stats := r.samplePixel(sampler, nil, x, y, nil)
+	return stats.color(), stats.n
+}
+
+// samplePixel накапливает сэмплы пикселя вместе с признаками для денойзера
+// и добавляет их в буфер тайла tile, если он задан
+func (r *Renderer) samplePixel(sampler Sampler, counters *rayCounters, x, y int, tile *filmTile) pixelStats {
+	var stats pixelStats
+	sample := func(index int) {
+		c, features, offset := r.renderSample(sampler, counters, x, y, index)
+		stats.add(c, features)
+		if tile != nil {
+			tile.add(x, y, offset, c)
+		}
+	}
+
+	if r.Adaptive == nil {
+		// Сэмплирование для антиалиасинга
+		for s := 0; s < r.SamplesPerPixel; s++ {
+			sample(s)
+		}
+		return stats
+	}
+
+	for !r.Adaptive.done(&stats) {
+		sample(stats.n)
+	}
+	return stats
+}
+
+// renderTile рендерит тайл в кадр dst. Прерывается между строками при отмене ctx.
+// Цвет пикселей собирается фильтром восстановления в плёнке film.
+func (r *Renderer) renderTile(ctx context.Context, dst *Frame, film *film, tile image.Rectangle) {
+	start := time.Now()
+	sampler := r.Sampler.Clone()
+	counters := r.Stats.counters(r.Scene)
+	buffer := film.tile(tile)
+	defer film.merge(buffer, dst)
+	defer r.Stats.addTile(r.Scene, tile, start, counters)
+
+	for y := tile.Min.Y; y < tile.Max.Y; y++ {
+		if ctx.Err() != nil {
+			return
+		}
+		for x := tile.Min.X; x < tile.Max.X; x++ {
+			stats := r.samplePixel(sampler, counters, x, y, buffer)
+			dst.SetFeatures(x, y, stats.averageFeatures(), stats.meanVariance())
+			dst.Samples[y*dst.Width+x] = stats.n
+		}
+	}
+}
+
+// Start запускает рендер в фоне. Кадр заполняется по мере готовности тайлов.
+func (r *Renderer) Start(ctx context.Context) (*Frame, *RenderJob) {
+	dst := NewFrame(r.Width, r.Height)
+	dst.EnableAOVs(r.AOVs)
+	film := newFilm(r.Width, r.Height, r.Filter, r.ToneMapper)
+	job := r.Scheduler.Start(ctx, r.Width, r.Height, func(ctx context.Context, tile image.Rectangle) {
+		r.renderTile(ctx, dst, film, tile)
+	})
+	return dst, job
+}
+
+// Render рендерит сцену и ждёт завершения
+func (r *Renderer) Render(ctx context.Context) (*Frame, error) {
+	dst, job := r.Start(ctx)
+	return dst, job.Wait()
+}
@@ -0,0 +1,130 @@
+package tracer
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+// testSky - вертикальный градиент вместо картинки скайбокса
+func testSky() *Skybox {
+	img := image.NewRGBA(image.Rect(0, 0, 16, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 16; x++ {
+			img.Set(x, y, color.RGBA{R: 90, G: uint8(120 + y*10), B: 230, A: 255})
+		}
+	}
+	return NewSkyboxFromImage(img)
+}
+
+// testHDRSky - HDR градиент с ярким солнцем, которое должно давать резкие тени
+func testHDRSky() *Skybox {
+	const width, height = 32, 16
+	rgb := make([]float32, 0, 3*width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x >= 20 && x < 22 && y >= 4 && y < 6 {
+				rgb = append(rgb, 60, 55, 45)
+				continue
+			}
+			t := float32(y) / height
+			rgb = append(rgb, 0.2+0.2*t, 0.3+0.2*t, 0.6)
+		}
+	}
+	return NewSkyboxFromRadiance(width, height, rgb)
+}
+
+// testScene - небольшая сцена без тора, который рендерится слишком долго для тестов
+func testScene(width, height int) *Scene {
+	return &Scene{
+		Objects: []SceneObject{
+			NewSphere(Vector{0, -1, -5}, 2, Material{
+				DiffuseColor:  Vector{1, 1, 0},
+				SpecularColor: Vector{1, 1, 1},
+				AmbientColor:  Vector{0.1, 0.1, 0.1},
+				Shininess:     32,
+			}),
+			NewCube(Vector{-4, 0, -8}, 2, Material{
+				DiffuseColor:  Vector{0.8, 0.5, 0.2},
+				SpecularColor: Vector{0.5, 0.5, 0.5},
+				AmbientColor:  Vector{0.1, 0.1, 0.1},
+				Shininess:     20,
+				Reflectivity:  0.3,
+			}),
+			NewInfinityChessBoard(2, Vector{0, 0, 0}, Vector{1, 1, 1}),
+		},
+		Light:  NewLight(Vector{0, 1, -1}, 1, Vector{1, 1, 1}, Vector{1, 1, 1}, Vector{0.2, 0.2, 0.2}),
+		Camera: NewCamera(Vector{0, 0, 10}, Vector{float64(width), float64(height), 0}, 60, 15, 0.5),
+		Skybox: testSky(),
+	}
+}
+
+// Рендер с одинаковым seed не зависит от числа рабочих и порядка тайлов
+func TestRenderDeterministic(t *testing.T) {
+	const width, height = 48, 24
+
+	for _, name := range SamplerNames {
+		t.Run(name, func(t *testing.T) {
+			var reference []byte
+			for _, workers := range []int{1, 3} {
+				for _, order := range []TileOrder{TileOrderScanline, TileOrderSpiral} {
+					sampler, err := NewSampler(name, 4, 42)
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					r := NewRenderer(testScene(width, height), width, height)
+					r.SamplesPerPixel = 4
+					r.Sampler = sampler
+					r.Scheduler = Scheduler{TileSize: 7, Order: order, Workers: workers}
+
+					frame, err := r.Render(context.Background())
+					if err != nil {
+						t.Fatal(err)
+					}
+					if reference == nil {
+						reference = frame.Image.Pix
+					} else if !bytes.Equal(reference, frame.Image.Pix) {
+						t.Fatalf("render with %d workers and %v order differs", workers, order)
+					}
+				}
+			}
+		})
+	}
+}
+
+// Фокус по щелчку ставится на расстояние до сферы под курсором, а небо не меняет фокус
+func TestFocusAt(t *testing.T) {
+	const width, height = 48, 24
+	scene := testScene(width, height)
+
+	// Чуть выше центра кадра луч смотрит вверх, мимо доски, и попадает в сферу
+	xy := Vector{width / 2, height/2 - 2, 0}
+	focused, ok := scene.FocusAt(xy)
+	if !ok {
+		t.Fatal("ray missed the sphere")
+	}
+
+	pinhole := scene.Camera
+	pinhole.Aperture = 0
+	sphereHit, hit := scene.Objects[0].Intersection(pinhole.GenerateRay(xy, 0.5, 0.5))
+	if !hit {
+		t.Fatal("pinhole ray missed the sphere")
+	}
+	if got, want := focused.Camera.FocusDistance, sphereHit.Distance; math.Abs(got-want) > 1e-9 {
+		t.Errorf("focus distance %.6f, want %.6f", got, want)
+	}
+	if scene.Camera.FocusDistance != 15 {
+		t.Error("FocusAt modified the original scene")
+	}
+	if focused.Camera.Aperture != scene.Camera.Aperture {
+		t.Error("FocusAt changed the aperture")
+	}
+
+	if same, ok := scene.FocusAt(Vector{width / 2, 0, 0}); ok || same != scene {
+		t.Error("sky pixel changed the focus")
+	}
+}
@@ -0,0 +1,246 @@
+package tracer
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// toRGBE упаковывает линейный цвет в общий порядок и три мантиссы формата Radiance
+func toRGBE(r, g, b float32) [4]byte {
+	v := math.Max(float64(r), math.Max(float64(g), float64(b)))
+	if v < 1e-32 {
+		return [4]byte{}
+	}
+
+	mantissa, exponent := math.Frexp(v)
+	scale := mantissa * 256 / v
+	return [4]byte{
+		byte(math.Max(0, float64(r)*scale)),
+		byte(math.Max(0, float64(g)*scale)),
+		byte(math.Max(0, float64(b)*scale)),
+		byte(exponent + 128),
+	}
+}
+
+// fromRGBE распаковывает пиксель Radiance в линейный цвет (по центру интервала мантиссы)
+func fromRGBE(p [4]byte) (r, g, b float32) {
+	if p[3] == 0 {
+		return 0, 0, 0
+	}
+	f := math.Ldexp(1, int(p[3])-(128+8))
+	return float32((float64(p[0]) + 0.5) * f),
+		float32((float64(p[1]) + 0.5) * f),
+		float32((float64(p[2]) + 0.5) * f)
+}
+
+// ReadHDR читает изображение Radiance (.hdr) с ориентацией "-Y H +X W".
+// Возвращает размеры и линейную яркость, по три канала на пиксель, строки сверху вниз.
+func ReadHDR(r io.Reader) (width, height int, rgb []float32, err error) {
+	in := bufio.NewReader(r)
+
+	magic, err := in.ReadString('\n')
+	if err != nil || !strings.HasPrefix(magic, "#?") {
+		return 0, 0, nil, errors.New("hdr: missing #? signature")
+	}
+
+	// Заголовок заканчивается пустой строкой
+	for {
+		line, err := in.ReadString('\n')
+		if err != nil {
+			return 0, 0, nil, fmt.Errorf("hdr: unterminated header: %w", err)
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if format, ok := strings.CutPrefix(line, "FORMAT="); ok && format != "32-bit_rle_rgbe" {
+			return 0, 0, nil, fmt.Errorf("hdr: unsupported format %q", format)
+		}
+	}
+
+	resolution, err := in.ReadString('\n')
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("hdr: missing resolution: %w", err)
+	}
+	if _, err := fmt.Sscanf(resolution, "-Y %d +X %d", &height, &width); err != nil {
+		return 0, 0, nil, fmt.Errorf("hdr: unsupported resolution line %q", strings.TrimSpace(resolution))
+	}
+	if width <= 0 || height <= 0 {
+		return 0, 0, nil, fmt.Errorf("hdr: invalid image size %dx%d", width, height)
+	}
+
+	rgb = make([]float32, 3*width*height)
+	scanline := make([][4]byte, width)
+	for y := 0; y < height; y++ {
+		if err := readRGBEScanline(in, scanline); err != nil {
+			return 0, 0, nil, fmt.Errorf("hdr: scanline %d: %w", y, err)
+		}
+		for x, p := range scanline {
+			i := 3 * (y*width + x)
+			rgb[i], rgb[i+1], rgb[i+2] = fromRGBE(p)
+		}
+	}
+	return width, height, rgb, nil
+}
+
+// readRGBEScanline читает строку в новом RLE формате или без сжатия
+func readRGBEScanline(in *bufio.Reader, scanline [][4]byte) error {
+	width := len(scanline)
+
+	var first [4]byte
+	if _, err := io.ReadFull(in, first[:]); err != nil {
+		return err
+	}
+	if width < 8 || width > 0x7fff || first[0] != 2 || first[1] != 2 || first[2]&0x80 != 0 {
+		// Строка без сжатия
+		scanline[0] = first
+		for x := 1; x < width; x++ {
+			if _, err := io.ReadFull(in, scanline[x][:]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if int(first[2])<<8|int(first[3]) != width {
+		return errors.New("scanline width mismatch")
+	}
+
+	for c := 0; c < 4; c++ {
+		for x := 0; x < width; {
+			count, err := in.ReadByte()
+			if err != nil {
+				return err
+			}
+
+			if count > 128 {
+				n := int(count) - 128
+				value, err := in.ReadByte()
+				if err != nil {
+					return err
+				}
+				if x+n > width {
+					return errors.New("run overflows scanline")
+				}
+				for ; n > 0; n-- {
+					scanline[x][c] = value
+					x++
+				}
+				continue
+			}
+
+			n := int(count)
+			if n == 0 || x+n > width {
+				return errors.New("invalid literal run")
+			}
+			for ; n > 0; n-- {
+				value, err := in.ReadByte()
+				if err != nil {
+					return err
+				}
+				scanline[x][c] = value
+				x++
+			}
+		}
+	}
+	return nil
+}
+
+// WriteHDR записывает изображение в формате Radiance (.hdr) с RLE сжатием строк.
+// rgb - линейная яркость, по три канала на пиксель, строки сверху вниз.
+func WriteHDR(w io.Writer, width, height int, rgb []float32) error {
+	if len(rgb) != 3*width*height {
+		return fmt.Errorf("hdr: expected %d values, got %d", 3*width*height, len(rgb))
+	}
+
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "#?RADIANCE\nFORMAT=32-bit_rle_rgbe\n\n-Y %d +X %d\n", height, width)
+
+	scanline := make([][4]byte, width)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := 3 * (y*width + x)
+			scanline[x] = toRGBE(rgb[i], rgb[i+1], rgb[i+2])
+		}
+		if err := writeRGBEScanline(out, scanline); err != nil {
+			return err
+		}
+	}
+	return out.Flush()
+}
+
+// writeRGBEScanline пишет строку в новом RLE формате: каждая из четырёх компонент отдельно.
+// Слишком короткие и слишком длинные строки RLE не поддерживают и пишутся как есть.
+func writeRGBEScanline(out *bufio.Writer, scanline [][4]byte) error {
+	width := len(scanline)
+	if width < 8 || width > 0x7fff {
+		for _, p := range scanline {
+			if _, err := out.Write(p[:]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if _, err := out.Write([]byte{2, 2, byte(width >> 8), byte(width & 0xff)}); err != nil {
+		return err
+	}
+
+	component := make([]byte, width)
+	for c := 0; c < 4; c++ {
+		for x := range scanline {
+			component[x] = scanline[x][c]
+		}
+		if err := writeRLE(out, component); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeRLE кодирует байты серий: (128 + n, байт) для повторов и (n, n байт) для остального
+func writeRLE(out *bufio.Writer, data []byte) error {
+	const minRun = 4
+
+	for i := 0; i < len(data); {
+		// Ищем начало ближайшей серии
+		runStart := i
+		runLength := 0
+		for runStart < len(data) {
+			runLength = 1
+			for runStart+runLength < len(data) && runLength < 127 && data[runStart+runLength] == data[runStart] {
+				runLength++
+			}
+			if runLength >= minRun {
+				break
+			}
+			runStart += runLength
+		}
+		if runLength < minRun {
+			runStart = len(data)
+		}
+
+		// Байты до серии пишутся без сжатия
+		for i < runStart {
+			n := min(128, runStart-i)
+			if err := out.WriteByte(byte(n)); err != nil {
+				return err
+			}
+			if _, err := out.Write(data[i : i+n]); err != nil {
+				return err
+			}
+			i += n
+		}
+
+		if runStart < len(data) {
+			if _, err := out.Write([]byte{byte(128 + runLength), data[runStart]}); err != nil {
+				return err
+			}
+			i = runStart + runLength
+		}
+	}
+	return nil
+}
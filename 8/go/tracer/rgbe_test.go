@@ -0,0 +1,45 @@
+package tracer
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+// Запись и чтение Radiance HDR сохраняют яркость с точностью мантиссы RGBE
+func TestHDRRoundTrip(t *testing.T) {
+	// Узкая строка пишется без сжатия, широкая - с RLE и длинными сериями
+	for _, width := range []int{5, 300} {
+		const height = 3
+		rgb := make([]float32, 3*width*height)
+		for i := range rgb {
+			if i%7 < 3 {
+				rgb[i] = float32(math.Exp(float64(i%23) - 10))
+			} else {
+				rgb[i] = 0.5
+			}
+		}
+
+		var buf bytes.Buffer
+		if err := WriteHDR(&buf, width, height, rgb); err != nil {
+			t.Fatal(err)
+		}
+		gotWidth, gotHeight, got, err := ReadHDR(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if gotWidth != width || gotHeight != height {
+			t.Fatalf("size %dx%d, want %dx%d", gotWidth, gotHeight, width, height)
+		}
+
+		for p := 0; p < width*height; p++ {
+			want := rgb[3*p : 3*p+3]
+			brightest := max(want[0], want[1], want[2])
+			for c := 0; c < 3; c++ {
+				if d := math.Abs(float64(got[3*p+c] - want[c])); d > float64(brightest)/128 {
+					t.Fatalf("width %d, pixel %d channel %d: got %g, want %g", width, p, c, got[3*p+c], want[c])
+				}
+			}
+		}
+	}
+}
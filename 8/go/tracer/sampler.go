@@ -0,0 +1,273 @@
+package tracer
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// Sampler выдаёт случайные числа в [0, 1) для одного сэмпла пикселя.
+// Измерения запрашиваются по порядку: пиксель (2D), линза (2D),
+// затем источники света и BSDF в порядке их обращения к сэмплеру.
+//
+// Сэмплер хранит состояние и не потокобезопасен: каждый рабочий получает свою копию через Clone.
+type Sampler interface {
+	StartSample(x, y, index int) // Начать сэмпл index пикселя (x, y)
+	Get1D() float64
+	Get2D() (float64, float64)
+	Clone() Sampler // Независимая копия для другого рабочего
+}
+
+// SamplerNames - названия сэмплеров для NewSampler
+var SamplerNames = []string{"independent", "stratified", "halton", "sobol"}
+
+// NewSampler создаёт сэмплер по названию. samplesPerPixel - сколько сэмплов рендер наберёт
+// в пикселе, по нему стратифицированный сэмплер выбирает размер сетки страт. Числа сэмплера зависят только от seed, пикселя, номера сэмпла
+// и измерения, поэтому рендер повторяется при любом числе рабочих и порядке тайлов.
+func NewSampler(name string, samplesPerPixel int, seed int64) (Sampler, error) {
+	switch name {
+	case "independent":
+		return NewIndependentSampler(seed), nil
+	case "stratified":
+		return NewStratifiedSampler(samplesPerPixel, seed), nil
+	case "halton":
+		return NewHaltonSampler(seed), nil
+	case "sobol":
+		return NewSobolSampler(seed), nil
+	default:
+		return nil, fmt.Errorf("unknown sampler %q (expected one of %v)", name, SamplerNames)
+	}
+}
+
+// toUnit переводит 32-битное целое в число из [0, 1)
+func toUnit(x uint32) float64 {
+	return float64(x) / (1 << 32)
+}
+
+// seed32 сворачивает 64-битный seed в 32 бита
+func seed32(seed int64) uint32 {
+	return uint32(seed) ^ uint32(uint64(seed)>>32)
+}
+
+// IndependentSampler выдаёт независимые равномерные числа, полученные хешированием
+// seed, пикселя, номера сэмпла и измерения
+type IndependentSampler struct {
+	seed      uint32
+	pixel     uint32
+	index     uint32
+	dimension uint32
+}
+
+func NewIndependentSampler(seed int64) *IndependentSampler {
+	return &IndependentSampler{seed: seed32(seed)}
+}
+
+func (s *IndependentSampler) StartSample(x, y, index int) {
+	s.pixel = hashInts(x, y)
+	s.index = uint32(index)
+	s.dimension = 0
+}
+
+func (s *IndependentSampler) Get1D() float64 {
+	d := s.dimension
+	s.dimension++
+	return toUnit(hashUint32(s.seed, s.pixel, s.index, d))
+}
+
+func (s *IndependentSampler) Get2D() (float64, float64) {
+	return s.Get1D(), s.Get1D()
+}
+
+func (s *IndependentSampler) Clone() Sampler {
+	clone := *s
+	return &clone
+}
+
+// StratifiedSampler делит каждое измерение пикселя на страты и берёт случайную точку
+// в страте. Сэмплы пикселя проходят страты в случайном порядке, свой для каждого измерения.
+// Сетка 2D измерений округляется вверх до квадрата, так что при неквадратном числе сэмплов
+// каждый сэмпл всё равно попадает в свою страту, а часть страт остаётся пустой.
+type StratifiedSampler struct {
+	strata    int // Страт по одной оси для 2D измерений
+	seed      uint32
+	pixel     uint32
+	index     int
+	dimension uint32
+}
+
+func NewStratifiedSampler(samplesPerPixel int, seed int64) *StratifiedSampler {
+	strata := max(1, int(math.Ceil(math.Sqrt(float64(samplesPerPixel)))))
+	return &StratifiedSampler{
+		strata: strata,
+		seed:   seed32(seed),
+	}
+}
+
+func (s *StratifiedSampler) StartSample(x, y, index int) {
+	s.pixel = hashInts(x, y)
+	s.index = index
+	s.dimension = 0
+}
+
+// stratum возвращает страту сэмпла: перестановка индексов своя для пикселя и измерения
+func (s *StratifiedSampler) stratum(count int) int {
+	s.dimension++
+	round := uint32(s.index / count)
+	return int(permute(uint32(s.index%count), uint32(count), hashUint32(s.pixel, s.seed, s.dimension, round)))
+}
+
+// jitter возвращает смещение внутри страты по оси axis текущего измерения
+func (s *StratifiedSampler) jitter(axis uint32) float64 {
+	return toUnit(hashUint32(s.seed, s.pixel, uint32(s.index), s.dimension, axis))
+}
+
+func (s *StratifiedSampler) Get1D() float64 {
+	count := s.strata * s.strata
+	return (float64(s.stratum(count)) + s.jitter(0)) / float64(count)
+}
+
+func (s *StratifiedSampler) Get2D() (float64, float64) {
+	st := s.stratum(s.strata * s.strata)
+	u := (float64(st%s.strata) + s.jitter(0)) / float64(s.strata)
+	v := (float64(st/s.strata) + s.jitter(1)) / float64(s.strata)
+	return u, v
+}
+
+func (s *StratifiedSampler) Clone() Sampler {
+	clone := *s
+	return &clone
+}
+
+// haltonPrimes - основания последовательности Хальтона по измерениям
+var haltonPrimes = []uint32{2, 3, 5, 7, 11, 13, 17, 19, 23, 29, 31, 37, 41, 43, 47, 53, 59, 61, 67, 71, 73, 79, 83, 89, 97}
+
+// HaltonSampler использует последовательность Хальтона с поворотом Крэнли-Паттерсона,
+// своим для каждого пикселя и измерения
+type HaltonSampler struct {
+	seed      uint32
+	pixel     uint32
+	index     uint32
+	dimension int
+}
+
+func NewHaltonSampler(seed int64) *HaltonSampler {
+	return &HaltonSampler{seed: seed32(seed)}
+}
+
+func (s *HaltonSampler) StartSample(x, y, index int) {
+	s.pixel = hashInts(x, y)
+	s.index = uint32(index)
+	s.dimension = 0
+}
+
+func (s *HaltonSampler) Get1D() float64 {
+	d := s.dimension
+	s.dimension++
+	if d >= len(haltonPrimes) {
+		// Простые числа закончились - дальше независимые числа
+		return toUnit(hashUint32(s.pixel, s.seed, uint32(d), s.index))
+	}
+
+	v := radicalInverse(s.index, haltonPrimes[d])
+	shift := toUnit(hashUint32(s.pixel, s.seed, uint32(d)))
+	v += shift
+	if v >= 1 {
+		v--
+	}
+	return v
+}
+
+func (s *HaltonSampler) Get2D() (float64, float64) {
+	return s.Get1D(), s.Get1D()
+}
+
+func (s *HaltonSampler) Clone() Sampler {
+	clone := *s
+	return &clone
+}
+
+// radicalInverse отражает запись числа i в системе счисления base относительно запятой
+func radicalInverse(i, base uint32) float64 {
+	inv := 1 / float64(base)
+	factor := inv
+	result := 0.0
+	for i > 0 {
+		result += float64(i%base) * factor
+		i /= base
+		factor *= inv
+	}
+	return result
+}
+
+// SobolSampler использует двумерную последовательность Соболя с перемешиванием Оуэна.
+// Каждая пара измерений получает своё перемешивание индекса и значений (Burley 2020),
+// поэтому последовательность дополняется на любое число измерений.
+type SobolSampler struct {
+	seed      uint32
+	pixel     uint32
+	index     uint32
+	dimension uint32
+}
+
+func NewSobolSampler(seed int64) *SobolSampler {
+	return &SobolSampler{seed: seed32(seed)}
+}
+
+func (s *SobolSampler) StartSample(x, y, index int) {
+	s.pixel = hashInts(x, y)
+	s.index = uint32(index)
+	s.dimension = 0
+}
+
+func (s *SobolSampler) Get1D() float64 {
+	u, _ := s.Get2D()
+	return u
+}
+
+func (s *SobolSampler) Get2D() (float64, float64) {
+	seed := hashUint32(s.pixel, s.seed, s.dimension)
+	s.dimension++
+
+	index := nestedUniformScramble(s.index, seed)
+	x, y := sobol2D(index)
+	x = nestedUniformScramble(x, hashUint32(seed, 1))
+	y = nestedUniformScramble(y, hashUint32(seed, 2))
+	return toUnit(x), toUnit(y)
+}
+
+func (s *SobolSampler) Clone() Sampler {
+	clone := *s
+	return &clone
+}
+
+// sobol2D возвращает i-ю точку первых двух измерений последовательности Соболя
+func sobol2D(i uint32) (uint32, uint32) {
+	x := bits.Reverse32(i)
+
+	var y uint32
+	v := uint32(1) << 31
+	for ; i > 0; i >>= 1 {
+		if i&1 != 0 {
+			y ^= v
+		}
+		v ^= v >> 1
+	}
+	return x, y
+}
+
+// laineKarrasPermutation перемешивает биты x от старших к младшим
+func laineKarrasPermutation(x, seed uint32) uint32 {
+	x += seed
+	x ^= x * 0x6c50b47c
+	x ^= x * 0xb82f1e52
+	x ^= x * 0xc7afe638
+	x ^= x * 0x8d22f6e6
+	return x
+}
+
+// nestedUniformScramble - перемешивание Оуэна по основанию 2
+func nestedUniformScramble(x, seed uint32) uint32 {
+	x = bits.Reverse32(x)
+	x = laineKarrasPermutation(x, seed)
+	return bits.Reverse32(x)
+}
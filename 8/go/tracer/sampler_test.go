@@ -0,0 +1,98 @@
+package tracer
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+// BenchmarkSamplerThroughput измеряет скорость выдачи сэмплов: на операцию приходится
+// начало сэмпла и четыре 2D измерения (пиксель, линза, свет, BSDF)
+func BenchmarkSamplerThroughput(b *testing.B) {
+	for _, name := range SamplerNames {
+		b.Run(name, func(b *testing.B) {
+			sampler, err := NewSampler(name, 16, 1)
+			if err != nil {
+				b.Fatal(err)
+			}
+			sampler = sampler.Clone()
+
+			var sink float64
+			for i := 0; i < b.N; i++ {
+				sampler.StartSample(i&63, (i>>6)&63, i>>12)
+				for d := 0; d < 4; d++ {
+					u, v := sampler.Get2D()
+					sink += u + v
+				}
+			}
+			if math.IsNaN(sink) {
+				b.Fatal("NaN sample")
+			}
+		})
+	}
+}
+
+// BenchmarkSamplerConvergence оценивает интеграл четверти круга (π/4) по единичному квадрату
+// в множестве пикселей и сообщает среднеквадратичную ошибку в метрике rmse.
+// Разрыв на границе круга похож на край объекта, который сглаживает антиалиасинг.
+func BenchmarkSamplerConvergence(b *testing.B) {
+	const pixels = 256
+	exact := math.Pi / 4
+
+	for _, spp := range []int{4, 16, 64} {
+		for _, name := range SamplerNames {
+			b.Run(fmt.Sprintf("%s/spp=%d", name, spp), func(b *testing.B) {
+				sampler, err := NewSampler(name, spp, 1)
+				if err != nil {
+					b.Fatal(err)
+				}
+				sampler = sampler.Clone()
+
+				var squaredError float64
+				for i := 0; i < b.N; i++ {
+					for p := 0; p < pixels; p++ {
+						inside := 0
+						for s := 0; s < spp; s++ {
+							sampler.StartSample(p, i, s)
+							sampler.Get2D() // Пропускаем измерение пикселя, берём линзу
+							u, v := sampler.Get2D()
+							if u*u+v*v < 1 {
+								inside++
+							}
+						}
+						e := float64(inside)/float64(spp) - exact
+						squaredError += e * e
+					}
+				}
+				b.ReportMetric(math.Sqrt(squaredError/float64(b.N*pixels)), "rmse")
+			})
+		}
+	}
+}
+
+// При неквадратном числе сэмплов сетка округляется вверх, и сэмплы пикселя не делят страты
+func TestStratifiedSamplerStrata(t *testing.T) {
+	for _, spp := range []int{3, 10, 64} {
+		sampler := NewStratifiedSampler(spp, 1)
+		strata := int(math.Ceil(math.Sqrt(float64(spp))))
+		for pixel := 0; pixel < 16; pixel++ {
+			cells := map[[2]int]bool{}
+			lines := map[int]bool{}
+			for s := 0; s < spp; s++ {
+				sampler.StartSample(pixel, 0, s)
+				u, v := sampler.Get2D()
+				cell := [2]int{int(u * float64(strata)), int(v * float64(strata))}
+				if cells[cell] {
+					t.Fatalf("spp %d, pixel %d: sample %d falls into taken 2D stratum %v", spp, pixel, s, cell)
+				}
+				cells[cell] = true
+
+				line := int(sampler.Get1D() * float64(strata*strata))
+				if lines[line] {
+					t.Fatalf("spp %d, pixel %d: sample %d falls into taken 1D stratum %d", spp, pixel, s, line)
+				}
+				lines[line] = true
+			}
+		}
+	}
+}
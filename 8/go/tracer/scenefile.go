@@ -0,0 +1,406 @@
+package tracer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SceneFile - файл сцены в формате JSON. Каждый раздел необязателен: отсутствующие
+// камера, свет, окружение и объекты берутся из сцены, собранной программой.
+// Векторы и цвета записываются массивами [x, y, z], пути отсчитываются от файла сцены.
+//
+//	{
+//	  "camera": {"position": [0, 0, 10], "lookAt": [0, 0, 0], "fov": 60, "aperture": 0.5},
+//	  "light": {"direction": [0, 1, -1]},
+//	  "environment": {"sky": {"sunElevation": 30}},
+//	  "objects": [
+//	    {"type": "sphere", "center": [0, -2, -15], "radius": 2, "material": {"diffuse": [1, 1, 0]}},
+//	    {"type": "chessboard", "y": 2, "color1": [0, 0, 0], "color2": [1, 1, 1]}
+//	  ],
+//	  "post": {
+//	    "bloom": {"threshold": 1.5, "intensity": 0.2},
+//	    "vignette": {"strength": 0.6},
+//	    "lut": {"path": "film.cube", "intensity": 0.8}
+//	  }
+//	}
+type SceneFile struct {
+	Camera      *CameraSpec      `json:"camera,omitempty"`
+	Light       *LightSpec       `json:"light,omitempty"`
+	Environment *EnvironmentSpec `json:"environment,omitempty"`
+	Objects     []ObjectSpec     `json:"objects,omitempty"`
+	Post        PostStack        `json:"post"`
+
+	path         string
+	objects      []SceneObject
+	environment  Environment
+	apertureMask *ApertureMask
+}
+
+// CameraSpec - камера в файле сцены
+type CameraSpec struct {
+	Position      [3]float64 `json:"position"`
+	LookAt        [3]float64 `json:"lookAt"`        // По умолчанию камера смотрит вдоль -Z
+	FOV           float64    `json:"fov"`           // Угол обзора в градусах, по умолчанию 60
+	FocusDistance float64    `json:"focusDistance"` // 0 - расстояние до lookAt
+	Aperture      float64    `json:"aperture"`      // Диаметр линзы, 0 - без глубины резкости
+	Blades        int        `json:"blades"`
+	BladeRotation float64    `json:"bladeRotation"`
+	CatEye        float64    `json:"catEye"`
+	ApertureMask  string     `json:"apertureMask,omitempty"` // Изображение формы диафрагмы
+}
+
+// UnmarshalJSON разбирает камеру, подставляя значения по умолчанию
+func (c *CameraSpec) UnmarshalJSON(data []byte) error {
+	type plain CameraSpec
+	v := struct {
+		plain
+		LookAt *[3]float64 `json:"lookAt"`
+	}{plain: plain{FOV: 60}}
+	if err := unmarshalStrict(data, &v); err != nil {
+		return err
+	}
+	*c = CameraSpec(v.plain)
+	if v.LookAt != nil {
+		c.LookAt = *v.LookAt
+	} else {
+		c.LookAt = [3]float64{c.Position[0], c.Position[1], c.Position[2] - 1}
+	}
+	return nil
+}
+
+// LightSpec - направленный источник света в файле сцены
+type LightSpec struct {
+	Direction [3]float64 `json:"direction"`
+	Intensity float64    `json:"intensity"` // По умолчанию 1
+	Color     [3]float64 `json:"color"`     // Диффузный цвет, по умолчанию белый
+	Specular  [3]float64 `json:"specular"`  // По умолчанию белый
+	Ambient   [3]float64 `json:"ambient"`   // По умолчанию 0.2
+}
+
+// UnmarshalJSON разбирает свет, подставляя значения по умолчанию
+func (l *LightSpec) UnmarshalJSON(data []byte) error {
+	type plain LightSpec
+	v := plain{
+		Direction: [3]float64{0, 1, -1},
+		Intensity: 1,
+		Color:     [3]float64{1, 1, 1},
+		Specular:  [3]float64{1, 1, 1},
+		Ambient:   [3]float64{0.2, 0.2, 0.2},
+	}
+	if err := unmarshalStrict(data, &v); err != nil {
+		return err
+	}
+	*l = LightSpec(v)
+	return nil
+}
+
+// EnvironmentSpec - окружение в файле сцены: изображение или процедурное небо
+type EnvironmentSpec struct {
+	Path      string   `json:"path,omitempty"`   // Панорама, крест или 6 граней куба через запятую
+	Layout    string   `json:"layout,omitempty"` // auto, equirect или cross
+	Rotation  float64  `json:"rotation"`         // Поворот вокруг вертикальной оси в градусах
+	Intensity float64  `json:"intensity"`        // Множитель яркости, по умолчанию 1
+	Sky       *SkySpec `json:"sky,omitempty"`    // Процедурное небо вместо изображения
+}
+
+// UnmarshalJSON разбирает окружение, подставляя значения по умолчанию
+func (e *EnvironmentSpec) UnmarshalJSON(data []byte) error {
+	type plain EnvironmentSpec
+	v := plain{Intensity: 1}
+	if err := unmarshalStrict(data, &v); err != nil {
+		return err
+	}
+	*e = EnvironmentSpec(v)
+	return nil
+}
+
+// SkySpec - процедурное небо. Без раздела light его солнце становится источником света сцены.
+type SkySpec struct {
+	SunElevation float64 `json:"sunElevation"` // По умолчанию 45
+	SunAzimuth   float64 `json:"sunAzimuth"`
+	Turbidity    float64 `json:"turbidity"`    // По умолчанию DefaultTurbidity
+	SunIntensity float64 `json:"sunIntensity"` // По умолчанию 1
+}
+
+// UnmarshalJSON разбирает небо, подставляя значения по умолчанию
+func (s *SkySpec) UnmarshalJSON(data []byte) error {
+	type plain SkySpec
+	v := plain{SunElevation: 45, Turbidity: DefaultTurbidity, SunIntensity: 1}
+	if err := unmarshalStrict(data, &v); err != nil {
+		return err
+	}
+	*s = SkySpec(v)
+	return nil
+}
+
+// ObjectSpec - объект в файле сцены. Используются поля, нужные его типу:
+//
+//	sphere      - center, radius
+//	cube        - center, size
+//	torus       - majorRadius, minorRadius (тор всегда в начале координат)
+//	tetrahedron - vertices, transform
+//	chessboard  - y, color1, color2 (материал задаётся цветами клеток)
+type ObjectSpec struct {
+	Type        string         `json:"type"`
+	Center      [3]float64     `json:"center"`
+	Radius      float64        `json:"radius"`
+	Size        float64        `json:"size"`
+	MajorRadius float64        `json:"majorRadius"`
+	MinorRadius float64        `json:"minorRadius"`
+	Vertices    [][3]float64   `json:"vertices,omitempty"`
+	Transform   *TransformSpec `json:"transform,omitempty"`
+	Y           float64        `json:"y"`
+	Color1      [3]float64     `json:"color1"`
+	Color2      [3]float64     `json:"color2"`
+	Material    MaterialSpec   `json:"material"`
+}
+
+// TransformSpec - преобразование вершин: масштаб, поворот вокруг Y, затем перенос
+type TransformSpec struct {
+	Translate [3]float64 `json:"translate"`
+	RotateY   float64    `json:"rotateY"` // В градусах
+	Scale     [3]float64 `json:"scale"`   // По умолчанию 1
+}
+
+// UnmarshalJSON разбирает преобразование, подставляя единичный масштаб
+func (t *TransformSpec) UnmarshalJSON(data []byte) error {
+	type plain TransformSpec
+	v := plain{Scale: [3]float64{1, 1, 1}}
+	if err := unmarshalStrict(data, &v); err != nil {
+		return err
+	}
+	*t = TransformSpec(v)
+	return nil
+}
+
+// MaterialSpec - материал объекта в файле сцены
+type MaterialSpec struct {
+	Diffuse      [3]float64 `json:"diffuse"`
+	Specular     [3]float64 `json:"specular"`
+	Ambient      [3]float64 `json:"ambient"`
+	Shininess    float64    `json:"shininess"`
+	Reflectivity float64    `json:"reflectivity"`
+}
+
+// unmarshalStrict разбирает JSON, отвергая неизвестные поля: json.Unmarshal внутри UnmarshalJSON
+// не наследует DisallowUnknownFields от декодера файла
+func unmarshalStrict(data []byte, v any) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+func vec3(v [3]float64) Vector {
+	return Vector{v[0], v[1], v[2]}
+}
+
+func (m MaterialSpec) material() Material {
+	return Material{
+		DiffuseColor:  vec3(m.Diffuse),
+		SpecularColor: vec3(m.Specular),
+		AmbientColor:  vec3(m.Ambient),
+		Shininess:     m.Shininess,
+		Reflectivity:  m.Reflectivity,
+	}
+}
+
+// object строит объект сцены
+func (o ObjectSpec) object() (SceneObject, error) {
+	material := o.Material.material()
+	switch o.Type {
+	case "sphere":
+		if o.Radius <= 0 {
+			return nil, fmt.Errorf("sphere needs a positive radius")
+		}
+		return NewSphere(vec3(o.Center), o.Radius, material), nil
+	case "cube":
+		if o.Size <= 0 {
+			return nil, fmt.Errorf("cube needs a positive size")
+		}
+		return NewCube(vec3(o.Center), o.Size, material), nil
+	case "torus":
+		if o.MajorRadius <= 0 || o.MinorRadius <= 0 {
+			return nil, fmt.Errorf("torus needs positive majorRadius and minorRadius")
+		}
+		return NewTorus(o.MajorRadius, o.MinorRadius, material), nil
+	case "tetrahedron":
+		if len(o.Vertices) != 4 {
+			return nil, fmt.Errorf("tetrahedron needs 4 vertices, got %d", len(o.Vertices))
+		}
+		v := o.Vertices
+		tetrahedron := NewTetrahedron(vec3(v[0]), vec3(v[1]), vec3(v[2]), vec3(v[3]), material)
+		if t := o.Transform; t != nil {
+			tetrahedron.ApplyTransform(Identity().
+				Multiply(Translate(t.Translate[0], t.Translate[1], t.Translate[2])).
+				Multiply(RotateY(degreesToRadians(t.RotateY))).
+				Multiply(Scale(t.Scale[0], t.Scale[1], t.Scale[2])))
+		}
+		return tetrahedron, nil
+	case "chessboard":
+		return NewInfinityChessBoard(o.Y, vec3(o.Color1), vec3(o.Color2)), nil
+	default:
+		return nil, fmt.Errorf("unknown object type %q (expected sphere, cube, torus, tetrahedron or chessboard)", o.Type)
+	}
+}
+
+// LoadSceneFile читает файл сцены и загружает изображения, на которые он ссылается
+func LoadSceneFile(path string) (*SceneFile, error) {
+	f, err := ReadSceneFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Load(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// ReadSceneFile разбирает файл сцены и строит объекты, но не загружает окружение, LUT и маску диафрагмы.
+// Незаданные параметры получают значения по умолчанию, пути отсчитываются от каталога файла сцены.
+func ReadSceneFile(path string) (*SceneFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scene file: %w", err)
+	}
+
+	f := &SceneFile{path: path}
+	if err := unmarshalStrict(data, f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	resolve := func(p string) string {
+		if p == "" || filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(filepath.Dir(path), p)
+	}
+	if env := f.Environment; env != nil {
+		if (env.Path == "") == (env.Sky == nil) {
+			return nil, fmt.Errorf("%s: environment needs either path or sky", path)
+		}
+		var faces []string
+		for _, face := range strings.Split(env.Path, ",") {
+			faces = append(faces, resolve(strings.TrimSpace(face)))
+		}
+		env.Path = strings.Join(faces, ",")
+	}
+	if f.Camera != nil {
+		f.Camera.ApertureMask = resolve(f.Camera.ApertureMask)
+	}
+	if f.Post.LUT != nil {
+		f.Post.LUT.Path = resolve(f.Post.LUT.Path)
+	}
+
+	for i, spec := range f.Objects {
+		obj, err := spec.object()
+		if err != nil {
+			return nil, fmt.Errorf("%s: objects[%d]: %w", path, i, err)
+		}
+		f.objects = append(f.objects, obj)
+	}
+	return f, nil
+}
+
+// Load загружает окружение, LUT и маску диафрагмы, на которые ссылается файл
+func (f *SceneFile) Load() error {
+	if env := f.Environment; env != nil {
+		if env.Sky != nil {
+			sky := NewProceduralSky(env.Sky.SunElevation, env.Sky.SunAzimuth, env.Sky.Turbidity)
+			sky.Intensity = env.Intensity
+			sky.SunIntensity = env.Sky.SunIntensity
+			f.environment = sky
+		} else {
+			layout := LayoutAuto
+			if env.Layout != "" {
+				var err error
+				if layout, err = ParseEnvironmentLayout(env.Layout); err != nil {
+					return fmt.Errorf("%s: %w", f.path, err)
+				}
+			}
+			loaded, err := LoadEnvironment(env.Path, EnvironmentOptions{Layout: layout, Rotation: env.Rotation, Intensity: env.Intensity})
+			if err != nil {
+				return fmt.Errorf("%s: %w", f.path, err)
+			}
+			f.environment = loaded
+		}
+	}
+
+	if f.Camera != nil && f.Camera.ApertureMask != "" {
+		mask, err := LoadApertureMask(f.Camera.ApertureMask)
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.path, err)
+		}
+		f.apertureMask = mask
+	}
+
+	if f.Post.LUT != nil {
+		if err := f.Post.LUT.Load(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Path возвращает путь к файлу сцены
+func (f *SceneFile) Path() string {
+	return f.path
+}
+
+// Dependencies возвращает файл сцены и все файлы, на которые он ссылается
+func (f *SceneFile) Dependencies() []string {
+	paths := []string{f.path}
+	if f.Environment != nil && f.Environment.Path != "" {
+		paths = append(paths, strings.Split(f.Environment.Path, ",")...)
+	}
+	if f.Camera != nil && f.Camera.ApertureMask != "" {
+		paths = append(paths, f.Camera.ApertureMask)
+	}
+	if f.Post.LUT != nil {
+		paths = append(paths, f.Post.LUT.Path)
+	}
+	return paths
+}
+
+// CameraChanged сообщает, отличается ли раздел camera от раздела в prev
+func (f *SceneFile) CameraChanged(prev *SceneFile) bool {
+	if f.Camera == nil || prev == nil || prev.Camera == nil {
+		return f.Camera != nil || (prev != nil && prev.Camera != nil)
+	}
+	return *f.Camera != *prev.Camera
+}
+
+// Scene возвращает копию base, в которой заданные в файле разделы заменены.
+// Кадр камеры берётся из base. Объекты, окружение и маска диафрагмы общие для всех сцен из файла.
+func (f *SceneFile) Scene(base *Scene) *Scene {
+	scene := *base
+
+	if c := f.Camera; c != nil {
+		position, target := vec3(c.Position), vec3(c.LookAt)
+		focusDistance := c.FocusDistance
+		if focusDistance <= 0 {
+			focusDistance = target.Sub(position).Magnitude()
+		}
+		camera := NewCamera(position, base.Camera.ScreenSize, c.FOV, focusDistance, c.Aperture)
+		camera.Bokeh = Bokeh{Blades: c.Blades, Rotation: c.BladeRotation, Mask: f.apertureMask, CatEye: c.CatEye}
+		scene.Camera = camera.LookAt(target)
+	}
+
+	if f.environment != nil {
+		scene.Skybox = f.environment
+		if sky, ok := f.environment.(*ProceduralSky); ok && f.Light == nil {
+			scene.Light = sky.SunLight()
+		}
+	}
+	if l := f.Light; l != nil {
+		scene.Light = NewLight(vec3(l.Direction), l.Intensity, vec3(l.Color), vec3(l.Specular), vec3(l.Ambient))
+	}
+
+	if len(f.objects) > 0 {
+		scene.Objects = f.objects
+	}
+	return &scene
+}
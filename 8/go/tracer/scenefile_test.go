@@ -0,0 +1,139 @@
+package tracer
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Пример scene.json повторяет сцену, которую собирает программа
+func TestSceneFileExample(t *testing.T) {
+	file, err := LoadSceneFile(filepath.Join("..", "scene.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := testScene(160, 60)
+	scene := file.Scene(base)
+
+	if len(scene.Objects) != 5 {
+		t.Fatalf("got %d objects, want 5", len(scene.Objects))
+	}
+	if len(base.Objects) != 3 {
+		t.Error("Scene modified the base scene")
+	}
+
+	camera := scene.Camera
+	// Без lookAt камера смотрит вдоль -Z, как NewCamera
+	if camera.Forward().Sub(Vector{0, 0, -1}).Magnitude() > 1e-6 || camera.FOV != 60 || camera.FocusDistance != 15 || camera.Aperture != 0.5 {
+		t.Errorf("camera %v looks along %v", camera, camera.Forward())
+	}
+	if camera.ScreenSize != base.Camera.ScreenSize {
+		t.Errorf("screen size %v, want the base %v", camera.ScreenSize, base.Camera.ScreenSize)
+	}
+
+	tetrahedron, ok := scene.Objects[2].(*Tetrahedron)
+	if !ok {
+		t.Fatalf("object 2 is %T, want *Tetrahedron", scene.Objects[2])
+	}
+	want := NewTetrahedron(Vector{3, -2, -10}, Vector{5, -2, -10}, Vector{4, 0, -10}, Vector{4, -2, -8}, Material{})
+	want.ApplyTransform(Identity().Multiply(Translate(-5, -1, 5)).Multiply(RotateY(math.Pi / 4)).Multiply(Scale(1.5, 1.5, 1.5)))
+	for i, v := range tetrahedron.Vertices {
+		if v.Sub(want.Vertices[i]).Magnitude() > 1e-9 {
+			t.Errorf("vertex %d = %v, want %v", i, v, want.Vertices[i])
+		}
+	}
+}
+
+func TestSceneFileSections(t *testing.T) {
+	dir := t.TempDir()
+	base := testScene(48, 24)
+
+	file, err := LoadSceneFile(writeTemp(t, dir, `{"light": {"intensity": 2}, "camera": {"position": [1, 2, 3]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	scene := file.Scene(base)
+	if len(scene.Objects) != len(base.Objects) || scene.Skybox != base.Skybox {
+		t.Error("sections missing from the file must come from the base scene")
+	}
+	if scene.Light.Strength != 2 || scene.Light.AmbientColor != (Vector{0.2, 0.2, 0.2}) {
+		t.Errorf("light %+v, want intensity 2 and default colors", scene.Light)
+	}
+	if forward := scene.Camera.Forward(); forward.Sub(Vector{0, 0, -1}).Magnitude() > 1e-6 || scene.Camera.FOV != 60 {
+		t.Errorf("camera without lookAt looks along %v with FOV %.0f, want -Z and 60", forward, scene.Camera.FOV)
+	}
+
+	sky, err := LoadSceneFile(writeTemp(t, dir, `{"environment": {"sky": {"sunElevation": 20}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	skyScene := sky.Scene(base)
+	if _, ok := skyScene.Skybox.(*ProceduralSky); !ok || skyScene.Light == base.Light {
+		t.Error("procedural sky must replace the environment and the light")
+	}
+
+	if !sky.CameraChanged(file) || file.CameraChanged(file) || sky.CameraChanged(sky) {
+		t.Error("CameraChanged must compare camera sections")
+	}
+	if deps := sky.Dependencies(); len(deps) != 1 || deps[0] != sky.Path() {
+		t.Errorf("dependencies %v, want only the scene file", deps)
+	}
+
+	for _, tc := range []struct{ config, want string }{
+		{`{"camera": {"fvo": 50}}`, "unknown field"},
+		{`{"post": {"vignette": {"strenght": 0.6}}}`, "unknown field"},
+		{`{"objects": [{"type": "cone"}]}`, "objects[0]: unknown object type"},
+		{`{"objects": [{"type": "sphere", "center": [0, 0, 0]}]}`, "objects[0]: sphere needs a positive radius"},
+		{`{"environment": {"intensity": 2}}`, "environment needs either path or sky"},
+		{`{"environment": {"path": "missing.hdr"}}`, "missing.hdr"},
+	} {
+		if _, err := LoadSceneFile(writeTemp(t, dir, tc.config)); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: error %v, want %q", tc.config, err, tc.want)
+		}
+	}
+
+	// Ссылки известны после разбора, даже если файлы по ним ещё не загружаются
+	missing, err := ReadSceneFile(writeTemp(t, dir, `{"environment": {"path": "sky.hdr"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deps := missing.Dependencies(); len(deps) != 2 || deps[1] != filepath.Join(dir, "sky.hdr") {
+		t.Errorf("dependencies %v, want the scene file and sky.hdr next to it", deps)
+	}
+}
+
+func TestFileWatcher(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "scene.json")
+	texture := filepath.Join(dir, "texture.png")
+	if err := os.WriteFile(path, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	w := NewFileWatcher(path, texture)
+	if w.Changed() {
+		t.Fatal("unchanged files reported as changed")
+	}
+
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if !w.Changed() {
+		t.Error("modification time change not detected")
+	}
+	if w.Changed() {
+		t.Error("change reported twice")
+	}
+
+	if err := os.WriteFile(texture, []byte("png"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w.Watch(path, texture)
+	if !w.Changed() {
+		t.Error("appearance of a watched file not detected")
+	}
+}
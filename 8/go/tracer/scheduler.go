@@ -0,0 +1,258 @@
+package tracer
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// TileOrder задаёт порядок обхода тайлов изображения
+type TileOrder int
+
+const (
+	TileOrderScanline TileOrder = iota // Построчно слева направо, сверху вниз
+	TileOrderHilbert                   // Вдоль кривой Гильберта
+	TileOrderSpiral                    // Спиралью от центра кадра
+)
+
+func (o TileOrder) String() string {
+	switch o {
+	case TileOrderScanline:
+		return "scanline"
+	case TileOrderHilbert:
+		return "hilbert"
+	case TileOrderSpiral:
+		return "spiral"
+	default:
+		return fmt.Sprintf("TileOrder(%d)", int(o))
+	}
+}
+
+// ParseTileOrder разбирает название порядка обхода тайлов
+func ParseTileOrder(name string) (TileOrder, error) {
+	for _, o := range []TileOrder{TileOrderScanline, TileOrderHilbert, TileOrderSpiral} {
+		if o.String() == name {
+			return o, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown tile order %q (expected scanline, hilbert or spiral)", name)
+}
+
+// SplitTiles разбивает область width x height на тайлы размера size в заданном порядке.
+// Крайние тайлы обрезаются по границе изображения.
+func SplitTiles(width, height, size int, order TileOrder) []image.Rectangle {
+	if size <= 0 {
+		size = max(width, height)
+	}
+	cols := (width + size - 1) / size
+	rows := (height + size - 1) / size
+
+	var cells []image.Point
+	switch order {
+	case TileOrderHilbert:
+		cells = hilbertCells(cols, rows)
+	case TileOrderSpiral:
+		cells = spiralCells(cols, rows)
+	default:
+		cells = scanlineCells(cols, rows)
+	}
+
+	bounds := image.Rect(0, 0, width, height)
+	tiles := make([]image.Rectangle, 0, len(cells))
+	for _, c := range cells {
+		tile := image.Rect(c.X*size, c.Y*size, (c.X+1)*size, (c.Y+1)*size)
+		tiles = append(tiles, tile.Intersect(bounds))
+	}
+	return tiles
+}
+
+func scanlineCells(cols, rows int) []image.Point {
+	cells := make([]image.Point, 0, cols*rows)
+	for y := 0; y < rows; y++ {
+		for x := 0; x < cols; x++ {
+			cells = append(cells, image.Point{x, y})
+		}
+	}
+	return cells
+}
+
+// hilbertCells упорядочивает клетки сетки по индексу на кривой Гильберта
+func hilbertCells(cols, rows int) []image.Point {
+	n := 1
+	for n < cols || n < rows {
+		n *= 2
+	}
+
+	cells := scanlineCells(cols, rows)
+	sort.Slice(cells, func(i, j int) bool {
+		return hilbertIndex(n, cells[i]) < hilbertIndex(n, cells[j])
+	})
+	return cells
+}
+
+// hilbertIndex возвращает расстояние вдоль кривой Гильберта для точки p в квадрате n x n
+func hilbertIndex(n int, p image.Point) int {
+	x, y := p.X, p.Y
+	d := 0
+	for s := n / 2; s > 0; s /= 2 {
+		rx, ry := 0, 0
+		if x&s > 0 {
+			rx = 1
+		}
+		if y&s > 0 {
+			ry = 1
+		}
+		d += s * s * ((3 * rx) ^ ry)
+
+		// Поворот квадранта
+		if ry == 0 {
+			if rx == 1 {
+				x = s - 1 - x
+				y = s - 1 - y
+			}
+			x, y = y, x
+		}
+	}
+	return d
+}
+
+// spiralCells обходит сетку по квадратной спирали, начиная с центральной клетки
+func spiralCells(cols, rows int) []image.Point {
+	total := cols * rows
+	cells := make([]image.Point, 0, total)
+	if total == 0 {
+		return cells
+	}
+
+	x, y := (cols-1)/2, (rows-1)/2
+	dirs := [4]image.Point{{1, 0}, {0, 1}, {-1, 0}, {0, -1}}
+	add := func() {
+		if x >= 0 && x < cols && y >= 0 && y < rows {
+			cells = append(cells, image.Point{x, y})
+		}
+	}
+
+	add()
+	for step, dir := 1, 0; len(cells) < total; step++ {
+		// Каждая длина шага проходится дважды: вправо-вниз, влево-вверх
+		for k := 0; k < 2; k++ {
+			for i := 0; i < step; i++ {
+				x += dirs[dir].X
+				y += dirs[dir].Y
+				add()
+			}
+			dir = (dir + 1) % 4
+		}
+	}
+	return cells
+}
+
+// Scheduler раздаёт тайлы изображения пулу рабочих горутин
+type Scheduler struct {
+	TileSize int       // Размер стороны тайла в пикселях
+	Order    TileOrder // Порядок выдачи тайлов
+	Workers  int       // Количество рабочих, по умолчанию runtime.NumCPU()
+}
+
+// NewScheduler создаёт планировщик с рабочими по числу процессоров
+func NewScheduler(tileSize int, order TileOrder) Scheduler {
+	return Scheduler{
+		TileSize: tileSize,
+		Order:    order,
+		Workers:  runtime.NumCPU(),
+	}
+}
+
+// RenderJob - запущенный рендер, который можно дождаться или отменить
+type RenderJob struct {
+	cancel     context.CancelFunc
+	done       chan struct{}
+	err        error
+	tilesDone  atomic.Int64
+	tilesTotal int
+}
+
+// Start запускает рендер области width x height. Функция render вызывается
+// для каждого тайла из рабочих горутин и должна сама проверять ctx внутри тайла.
+func (s Scheduler) Start(ctx context.Context, width, height int, render func(ctx context.Context, tile image.Rectangle)) *RenderJob {
+	ctx, cancel := context.WithCancel(ctx)
+	tiles := SplitTiles(width, height, s.TileSize, s.Order)
+	job := &RenderJob{
+		cancel:     cancel,
+		done:       make(chan struct{}),
+		tilesTotal: len(tiles),
+	}
+
+	queue := make(chan image.Rectangle)
+	go func() {
+		defer close(queue)
+		for _, tile := range tiles {
+			select {
+			case queue <- tile:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	workers := s.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for tile := range queue {
+				if ctx.Err() != nil {
+					return
+				}
+				render(ctx, tile)
+				if ctx.Err() == nil {
+					job.tilesDone.Add(1)
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		job.err = ctx.Err()
+		cancel()
+		close(job.done)
+	}()
+
+	return job
+}
+
+// Run запускает рендер и блокируется до его завершения или отмены
+func (s Scheduler) Run(ctx context.Context, width, height int, render func(ctx context.Context, tile image.Rectangle)) error {
+	return s.Start(ctx, width, height, render).Wait()
+}
+
+// Done закрывается, когда все рабочие остановились
+func (j *RenderJob) Done() <-chan struct{} {
+	return j.done
+}
+
+// Wait ждёт завершения рендера. Возвращает ошибку контекста, если рендер был отменён.
+func (j *RenderJob) Wait() error {
+	<-j.done
+	return j.err
+}
+
+// Cancel останавливает рендер. Тайлы, которые уже рисуются, дорисовываются до проверки контекста.
+func (j *RenderJob) Cancel() {
+	j.cancel()
+}
+
+// Progress возвращает количество готовых тайлов и их общее число
+func (j *RenderJob) Progress() (done, total int) {
+	return int(j.tilesDone.Load()), j.tilesTotal
+}
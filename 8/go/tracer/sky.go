@@ -0,0 +1,165 @@
+package tracer
+
+import "math"
+
+const (
+	// Яркость неба Preetham в ккд/м² переводится так, что солнце с освещённостью около 100 клк
+	// соответствует DirectionalLight с Strength = 1 (в диффузной составляющей Фонга нет деления на π)
+	skyLuminanceScale = math.Pi / 100
+
+	DefaultTurbidity = 3      // Мутность атмосферы: 2 - очень ясно, 10 - дымка
+	sunAngularRadius = 0.2665 // Угловой радиус солнечного диска в градусах
+)
+
+// ProceduralSky - аналитическое небо Preetham (1999) с солнечным диском.
+// Солнце одновременно светит на сцену как направленный источник (см. SunLight),
+// поэтому при освещении окружением диск не учитывается.
+type ProceduralSky struct {
+	Intensity    float64 // Множитель яркости неба
+	SunIntensity float64 // Сила солнца как источника света
+
+	sun          Vector     // Направление на солнце
+	thetaSun     float64    // Зенитный угол солнца
+	zenith       [3]float64 // Y, x, y в зените
+	perez        [3][5]float64
+	perezZenith  [3]float64 // F(0, θs) для нормировки
+	sunColor     Vector     // Цвет солнца после прохождения атмосферы
+	distribution *Skybox    // Панорама неба без солнца для выбора направлений
+}
+
+// NewProceduralSky создаёт небо для солнца на высоте elevation над горизонтом и азимуте azimuth
+// (в градусах, азимут 0 - за камерой по умолчанию) при мутности turbidity.
+// Высота ограничивается диапазоном [0.5, 90]: модель не описывает сумерки.
+func NewProceduralSky(elevation, azimuth, turbidity float64) *ProceduralSky {
+	elevation = math.Max(0.5, math.Min(90, elevation)) * math.Pi / 180
+	azimuth *= math.Pi / 180
+	t := math.Max(1.7, turbidity)
+
+	s := &ProceduralSky{
+		Intensity:    1,
+		SunIntensity: 1,
+		// +Y направлена вниз, как в Camera.Orbit
+		sun: Vector{
+			math.Cos(elevation) * math.Sin(azimuth),
+			-math.Sin(elevation),
+			math.Cos(elevation) * math.Cos(azimuth),
+		},
+		thetaSun: math.Pi/2 - elevation,
+	}
+
+	s.perez = [3][5]float64{
+		{0.1787*t - 1.4630, -0.3554*t + 0.4275, -0.0227*t + 5.3251, 0.1206*t - 2.5771, -0.0670*t + 0.3703},
+		{-0.0193*t - 0.2592, -0.0665*t + 0.0008, -0.0004*t + 0.2125, -0.0641*t - 0.8989, -0.0033*t + 0.0452},
+		{-0.0167*t - 0.2608, -0.0950*t + 0.0092, -0.0079*t + 0.2102, -0.0441*t - 1.6537, -0.0109*t + 0.0529},
+	}
+
+	theta := s.thetaSun
+	theta2, theta3 := theta*theta, theta*theta*theta
+	chi := (4.0/9 - t/120) * (math.Pi - 2*theta)
+	s.zenith = [3]float64{
+		(4.0453*t-4.9710)*math.Tan(chi) - 0.2155*t + 2.4192,
+		t*t*(0.00166*theta3-0.00375*theta2+0.00209*theta) +
+			t*(-0.02903*theta3+0.06377*theta2-0.03202*theta+0.00394) +
+			(0.11693*theta3 - 0.21196*theta2 + 0.06052*theta + 0.25886),
+		t*t*(0.00275*theta3-0.00610*theta2+0.00317*theta) +
+			t*(-0.04214*theta3+0.08970*theta2-0.04153*theta+0.00516) +
+			(0.15346*theta3 - 0.26756*theta2 + 0.06670*theta + 0.26688),
+	}
+	for i := range s.perezZenith {
+		s.perezZenith[i] = perezFunction(s.perez[i], 0, theta)
+	}
+
+	// Цвет солнца нормирован на солнце в зените, чтобы днём свет был почти белым
+	zenithSun := sunTransmittance(0, t)
+	s.sunColor = multiplyColors(sunTransmittance(theta, t), Vector{1 / zenithSun.X, 1 / zenithSun.Y, 1 / zenithSun.Z})
+
+	s.distribution = newSkyboxFromFunc(128, 64, s.skyRadiance)
+	return s
+}
+
+// perezFunction - распределение яркости Perez: θ - зенитный угол взгляда, γ - угол до солнца
+func perezFunction(c [5]float64, theta, gamma float64) float64 {
+	cosGamma := math.Cos(gamma)
+	return (1 + c[0]*math.Exp(c[1]/math.Cos(theta))) * (1 + c[2]*math.Exp(c[3]*gamma) + c[4]*cosGamma*cosGamma)
+}
+
+// sunTransmittance - пропускание атмосферы для солнца на зенитном угле theta:
+// рэлеевское рассеяние и аэрозоли (формула Ангстрема), для длин волн 680, 550 и 440 нм
+func sunTransmittance(theta, turbidity float64) Vector {
+	// Относительная оптическая масса воздуха (Kasten, Young)
+	zenithDeg := theta * 180 / math.Pi
+	mass := 1 / (math.Cos(theta) + 0.50572*math.Pow(96.07995-zenithDeg, -1.6364))
+
+	beta := 0.04608*turbidity - 0.04586
+	channel := func(lambda float64) float64 {
+		rayleigh := 0.008735 * math.Pow(lambda, -4.08)
+		aerosol := beta * math.Pow(lambda, -1.3)
+		return math.Exp(-mass * (rayleigh + aerosol))
+	}
+	return Vector{channel(0.680), channel(0.550), channel(0.440)}
+}
+
+// skyRadiance - яркость неба без солнечного диска в линейном sRGB.
+// Ниже горизонта - свет горизонта, ослабленный землёй.
+func (s *ProceduralSky) skyRadiance(direction Vector) Vector {
+	cosTheta := -direction.Y
+	ground := 1.0
+	if cosTheta < 0 {
+		ground = 0.3
+	}
+	cosTheta = math.Max(cosTheta, 0.01)
+	theta := math.Acos(cosTheta)
+	gamma := math.Acos(math.Max(-1, math.Min(1, direction.Normalize().Dot(s.sun))))
+
+	var yxy [3]float64
+	for i := range yxy {
+		yxy[i] = s.zenith[i] * perezFunction(s.perez[i], theta, gamma) / s.perezZenith[i]
+	}
+
+	// Yxy -> XYZ -> линейный sRGB
+	luminance, x, y := yxy[0]*skyLuminanceScale*ground, yxy[1], yxy[2]
+	X := x / y * luminance
+	Z := (1 - x - y) / y * luminance
+	return Vector{
+		math.Max(0, 3.2406*X-1.5372*luminance-0.4986*Z),
+		math.Max(0, -0.9689*X+1.8758*luminance+0.0415*Z),
+		math.Max(0, 0.0557*X-0.2040*luminance+1.0570*Z),
+	}
+}
+
+// SunDirection возвращает единичное направление на солнце
+func (s *ProceduralSky) SunDirection() Vector {
+	return s.sun
+}
+
+// SunLight возвращает направленный источник, совпадающий с солнечным диском.
+// Фоновый свет берётся из неба в зените.
+func (s *ProceduralSky) SunLight() DirectionalLight {
+	ambient := s.skyRadiance(Vector{0, -1, 0}).Mul(s.Intensity)
+	return NewLight(s.sun.Neg(), s.SunIntensity, s.sunColor, s.sunColor, ambient)
+}
+
+// GetImageCoords возвращает яркость неба, включая солнечный диск
+func (s *ProceduralSky) GetImageCoords(direction Vector) Vector {
+	radiance := s.skyRadiance(direction).Mul(s.Intensity)
+
+	// Яркость диска такова, что его освещённость равна силе направленного источника
+	cosRadius := math.Cos(sunAngularRadius * math.Pi / 180)
+	if direction.Normalize().Dot(s.sun) >= cosRadius && -direction.Y > 0 {
+		solidAngle := 2 * math.Pi * (1 - cosRadius)
+		radiance = radiance.Add(s.sunColor.Mul(s.SunIntensity / solidAngle))
+	}
+	return radiance
+}
+
+// Sample выбирает направление на небо пропорционально яркости.
+// Солнце светит через SunLight, поэтому яркость возвращается без диска.
+func (s *ProceduralSky) Sample(u1, u2 float64) (Vector, Vector, float64) {
+	direction, _, pdf := s.distribution.Sample(u1, u2)
+	return direction, s.skyRadiance(direction).Mul(s.Intensity), pdf
+}
+
+// Pdf возвращает плотность вероятности выбора направления методом Sample
+func (s *ProceduralSky) Pdf(direction Vector) float64 {
+	return s.distribution.Pdf(direction)
+}
@@ -0,0 +1,226 @@
+package tracer
+
+import (
+	"image"
+	"math"
+	"sort"
+)
+
+// Skybox - равнопромежуточная панорама окружения в линейных значениях
+type Skybox struct {
+	path          string
+	width, height int
+	pixels        []float32 // Линейная яркость, по три канала на пиксель
+
+	Rotation  float64 // Поворот вокруг вертикальной оси в градусах
+	Intensity float64 // Множитель яркости
+
+	// Распределение для выбора направлений пропорционально яркости
+	rowCDF    []float64   // Функция распределения строк, height+1 значений
+	columnCDF [][]float64 // Функции распределения пикселей в строках, по width+1 значений
+	total     float64     // Сумма весов пикселей
+}
+
+// NewSkybox загружает панораму: .hdr как линейную яркость, остальные форматы как sRGB
+func NewSkybox(path string) (*Skybox, error) {
+	width, height, rgb, err := loadRadiance(path)
+	if err != nil {
+		return nil, err
+	}
+
+	skybox := NewSkyboxFromRadiance(width, height, rgb)
+	skybox.path = path
+	return skybox, nil
+}
+
+// NewSkyboxFromImage создаёт скайбокс из уже загруженной равнопромежуточной панорамы в sRGB
+func NewSkyboxFromImage(img image.Image) *Skybox {
+	width, height, rgb := imageRadiance(img)
+	return NewSkyboxFromRadiance(width, height, rgb)
+}
+
+// NewSkyboxFromRadiance создаёт скайбокс из линейной яркости, по три канала на пиксель
+func NewSkyboxFromRadiance(width, height int, rgb []float32) *Skybox {
+	s := &Skybox{
+		width:     width,
+		height:    height,
+		pixels:    rgb,
+		Intensity: 1,
+	}
+	s.buildDistribution()
+	return s
+}
+
+// NewSkyboxFromEnvironment переводит окружение в равнопромежуточную панораму.
+// Поворот и яркость исходного окружения запекаются в пиксели.
+func NewSkyboxFromEnvironment(env Environment, width, height int) *Skybox {
+	return newSkyboxFromFunc(width, height, env.GetImageCoords)
+}
+
+// newSkyboxFromFunc строит панораму, вычисляя яркость radiance в центрах пикселей
+func newSkyboxFromFunc(width, height int, radiance func(Vector) Vector) *Skybox {
+	rgb := make([]float32, 0, 3*width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := radiance(equirectDirection((float64(x)+0.5)/float64(width), (float64(y)+0.5)/float64(height)))
+			rgb = append(rgb, float32(c.X), float32(c.Y), float32(c.Z))
+		}
+	}
+	return NewSkyboxFromRadiance(width, height, rgb)
+}
+
+// Radiance возвращает размеры и линейную яркость панорамы без поворота и множителя
+func (s *Skybox) Radiance() (width, height int, rgb []float32) {
+	return s.width, s.height, s.pixels
+}
+
+// buildDistribution строит функции распределения по яркости пикселей.
+// Вес пикселя учитывает, что строки у полюсов занимают меньший телесный угол.
+func (s *Skybox) buildDistribution() {
+	s.rowCDF = make([]float64, s.height+1)
+	s.columnCDF = make([][]float64, s.height)
+	s.total = 0
+
+	for y := 0; y < s.height; y++ {
+		cosLatitude := math.Cos((float64(y)+0.5)/float64(s.height)*math.Pi - math.Pi/2)
+		cdf := make([]float64, s.width+1)
+		for x := 0; x < s.width; x++ {
+			cdf[x+1] = cdf[x] + s.pixel(x, y).Luminance()*cosLatitude
+		}
+		s.columnCDF[y] = cdf
+		s.rowCDF[y+1] = s.rowCDF[y] + cdf[s.width]
+	}
+	s.total = s.rowCDF[s.height]
+}
+
+func (s *Skybox) pixel(x, y int) Vector {
+	i := 3 * (y*s.width + x)
+	return Vector{float64(s.pixels[i]), float64(s.pixels[i+1]), float64(s.pixels[i+2])}
+}
+
+// toImage переводит направление в координаты панорамы [0, 1) x [0, 1] с учётом поворота
+func (s *Skybox) toImage(direction Vector) (u, v float64) {
+	return equirectCoords(rotateY(direction, -s.Rotation*math.Pi/180))
+}
+
+// fromImage переводит координаты панорамы обратно в единичное направление
+func (s *Skybox) fromImage(u, v float64) Vector {
+	return rotateY(equirectDirection(u, v), s.Rotation*math.Pi/180)
+}
+
+// equirectCoords переводит направление в координаты равнопромежуточной проекции
+func equirectCoords(direction Vector) (u, v float64) {
+	u = 0.5 + math.Atan2(direction.Z, direction.X)/(2*math.Pi)
+	v = 0.5 + math.Asin(math.Max(-1, math.Min(1, direction.Y)))/math.Pi
+	return u, v
+}
+
+// equirectDirection - обратное к equirectCoords преобразование
+func equirectDirection(u, v float64) Vector {
+	azimuth := (u - 0.5) * 2 * math.Pi
+	latitude := (v - 0.5) * math.Pi
+	return Vector{
+		math.Cos(latitude) * math.Cos(azimuth),
+		math.Sin(latitude),
+		math.Cos(latitude) * math.Sin(azimuth),
+	}
+}
+
+// GetImageCoords возвращает яркость окружения в направлении normal с билинейной фильтрацией
+func (s *Skybox) GetImageCoords(normal Vector) Vector {
+	u, v := s.toImage(normal)
+
+	// Центры пикселей находятся в половинных координатах
+	fx := u*float64(s.width) - 0.5
+	fy := v*float64(s.height) - 0.5
+	x0 := int(math.Floor(fx))
+	y0 := int(math.Floor(fy))
+	tx := fx - float64(x0)
+	ty := fy - float64(y0)
+
+	// По горизонтали панорама замкнута, по вертикали обрезается
+	wrap := func(x int) int { return ((x % s.width) + s.width) % s.width }
+	x1 := wrap(x0 + 1)
+	x0 = wrap(x0)
+	y1 := clamp(y0+1, 0, s.height-1)
+	y0 = clamp(y0, 0, s.height-1)
+
+	top := s.pixel(x0, y0).Mul(1 - tx).Add(s.pixel(x1, y0).Mul(tx))
+	bottom := s.pixel(x0, y1).Mul(1 - tx).Add(s.pixel(x1, y1).Mul(tx))
+	return top.Mul(1 - ty).Add(bottom.Mul(ty)).Mul(s.Intensity)
+}
+
+// Sample выбирает направление на окружение пропорционально яркости панорамы.
+// Возвращает направление, яркость в нём и плотность вероятности по телесному углу.
+func (s *Skybox) Sample(u1, u2 float64) (Vector, Vector, float64) {
+	if s.total <= 0 {
+		// Чёрная панорама: равномерно по сфере
+		z := 1 - 2*u1
+		r := math.Sqrt(math.Max(0, 1-z*z))
+		phi := 2 * math.Pi * u2
+		direction := Vector{r * math.Cos(phi), r * math.Sin(phi), z}
+		return direction, s.GetImageCoords(direction), 1 / (4 * math.Pi)
+	}
+
+	y, fy := sampleCDF(s.rowCDF, u2)
+	x, fx := sampleCDF(s.columnCDF[y], u1)
+
+	u := (float64(x) + fx) / float64(s.width)
+	v := (float64(y) + fy) / float64(s.height)
+	direction := s.fromImage(u, v)
+	return direction, s.GetImageCoords(direction), s.pdf(x, y, v)
+}
+
+// Pdf возвращает плотность вероятности выбора направления методом Sample
+func (s *Skybox) Pdf(direction Vector) float64 {
+	if s.total <= 0 {
+		return 1 / (4 * math.Pi)
+	}
+	u, v := s.toImage(direction)
+	x := clamp(int(u*float64(s.width)), 0, s.width-1)
+	y := clamp(int(v*float64(s.height)), 0, s.height-1)
+	return s.pdf(x, y, v)
+}
+
+// pdf переводит плотность пикселя (x, y) из координат панорамы в телесный угол:
+// пиксель занимает 2π² cos(широты) / (width * height) стерадиан
+func (s *Skybox) pdf(x, y int, v float64) float64 {
+	cosLatitude := math.Cos((v - 0.5) * math.Pi)
+	if cosLatitude <= 0 {
+		return 0
+	}
+	weight := s.columnCDF[y][x+1] - s.columnCDF[y][x]
+	pdfImage := weight / s.total * float64(s.width*s.height)
+	return pdfImage / (2 * math.Pi * math.Pi * cosLatitude)
+}
+
+// sampleCDF находит интервал функции распределения cdf, в который попадает u,
+// и положение u внутри него
+func sampleCDF(cdf []float64, u float64) (int, float64) {
+	n := len(cdf) - 1
+	target := u * cdf[n]
+	i := sort.Search(n, func(i int) bool { return cdf[i+1] > target })
+	i = min(i, n-1)
+
+	width := cdf[i+1] - cdf[i]
+	if width <= 0 {
+		return i, 0.5
+	}
+	return i, math.Min((target-cdf[i])/width, math.Nextafter(1, 0))
+}
+
+// rotateY поворачивает вектор вокруг вертикальной оси на angle радиан
+func rotateY(v Vector, angle float64) Vector {
+	sin, cos := math.Sincos(angle)
+	return Vector{v.X*cos + v.Z*sin, v.Y, -v.X*sin + v.Z*cos}
+}
+
+func clamp(value, min, max int) int {
+	if value < min {
+		return min
+	}
+	if value > max {
+		return max
+	}
+	return value
+}
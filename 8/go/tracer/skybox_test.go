@@ -0,0 +1,40 @@
+package tracer
+
+import (
+	"math"
+	"testing"
+)
+
+// Плотность, которую возвращает Sample, совпадает с Pdf и нормирована по сфере
+func TestSkyboxPdf(t *testing.T) {
+	sky := testHDRSky()
+	sky.Rotation = 40
+
+	sampler := NewIndependentSampler(7)
+	for i := 0; i < 1000; i++ {
+		sampler.StartSample(i, 0, 0)
+		direction, _, pdf := sky.Sample(sampler.Get2D())
+		if math.Abs(direction.Magnitude()-1) > 1e-9 {
+			t.Fatalf("sample %d: direction %v is not normalized", i, direction)
+		}
+		if want := sky.Pdf(direction); math.Abs(pdf-want) > 1e-6*want {
+			t.Fatalf("sample %d: Sample pdf %g, Pdf %g", i, pdf, want)
+		}
+	}
+
+	// Интеграл плотности по сфере через равномерные направления
+	const n = 200000
+	integral := 0.0
+	for i := 0; i < n; i++ {
+		sampler.StartSample(i, 1, 0)
+		u, v := sampler.Get2D()
+		z := 1 - 2*u
+		r := math.Sqrt(1 - z*z)
+		direction := Vector{r * math.Cos(2*math.Pi*v), r * math.Sin(2*math.Pi*v), z}
+		integral += sky.Pdf(direction) * 4 * math.Pi
+	}
+	integral /= n
+	if math.Abs(integral-1) > 0.02 {
+		t.Errorf("pdf integrates to %.4f over the sphere, want 1", integral)
+	}
+}
@@ -0,0 +1,248 @@
+package tracer
+
+import (
+	"fmt"
+	"image"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RayKind - назначение луча для статистики рендера
+type RayKind int
+
+const (
+	RayPrimary    RayKind = iota // Луч из камеры
+	RayShadow                    // Проверка видимости источника света или окружения
+	RayReflection                // Отражённый луч
+	RayOcclusion                 // Луч окклюзии фонового света
+
+	rayKinds = iota
+)
+
+func (k RayKind) String() string {
+	switch k {
+	case RayPrimary:
+		return "primary"
+	case RayShadow:
+		return "shadow"
+	case RayReflection:
+		return "reflection"
+	case RayOcclusion:
+		return "occlusion"
+	default:
+		return fmt.Sprintf("RayKind(%d)", int(k))
+	}
+}
+
+// rayCounters - счётчики одного тайла. Рабочий пишет в них без блокировок,
+// а в общую статистику они сливаются по завершении тайла.
+// Методы ничего не делают у nil, так что без статистики счётчики не передаются.
+type rayCounters struct {
+	rays  [rayKinds]int64
+	tests []int64 // Проверок пересечения по номеру объекта в сцене
+}
+
+func newRayCounters(objects int) *rayCounters {
+	return &rayCounters{tests: make([]int64, objects)}
+}
+
+// ray учитывает выпущенный луч
+func (c *rayCounters) ray(kind RayKind) {
+	if c != nil {
+		c.rays[kind]++
+	}
+}
+
+// test учитывает проверку пересечения луча с объектом номер i
+func (c *rayCounters) test(i int) {
+	if c != nil && i < len(c.tests) {
+		c.tests[i]++
+	}
+}
+
+// RenderStats собирает счётчики лучей, проверок пересечения по типам объектов и время тайлов.
+// Рабочие сливают в неё счётчики тайлов, читать можно во время рендера.
+type RenderStats struct {
+	mu    sync.Mutex
+	start time.Time // Начало первого тайла
+	end   time.Time // Конец последнего тайла
+	rays  [rayKinds]int64
+	tests map[string]int64
+	tiles TileTimes
+}
+
+// TileTimes - время рендера тайлов
+type TileTimes struct {
+	Count   int
+	Total   time.Duration
+	Min     time.Duration
+	Max     time.Duration
+	Slowest image.Rectangle // Самый долгий тайл
+}
+
+// Mean возвращает среднее время тайла
+func (t TileTimes) Mean() time.Duration {
+	if t.Count == 0 {
+		return 0
+	}
+	return t.Total / time.Duration(t.Count)
+}
+
+// NewRenderStats создаёт пустую статистику
+func NewRenderStats() *RenderStats {
+	return &RenderStats{tests: map[string]int64{}}
+}
+
+// Reset обнуляет статистику, например при перезапуске прогрессивного рендера
+func (s *RenderStats) Reset() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.start, s.end = time.Time{}, time.Time{}
+	s.rays = [rayKinds]int64{}
+	clear(s.tests)
+	s.tiles = TileTimes{}
+}
+
+// counters возвращает счётчики для нового тайла сцены scene, nil без статистики
+func (s *RenderStats) counters(scene *Scene) *rayCounters {
+	if s == nil {
+		return nil
+	}
+	return newRayCounters(len(scene.Objects))
+}
+
+// addTile сливает счётчики тайла, начатого в start, в статистику
+func (s *RenderStats) addTile(scene *Scene, tile image.Rectangle, start time.Time, c *rayCounters) {
+	if s == nil {
+		return
+	}
+	end := time.Now()
+	elapsed := end.Sub(start)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.start.IsZero() || start.Before(s.start) {
+		s.start = start
+	}
+	if end.After(s.end) {
+		s.end = end
+	}
+	for kind, n := range c.rays {
+		s.rays[kind] += n
+	}
+	for i, n := range c.tests {
+		if n > 0 {
+			s.tests[objectKind(scene.Objects[i])] += n
+		}
+	}
+
+	t := &s.tiles
+	if t.Count == 0 || elapsed < t.Min {
+		t.Min = elapsed
+	}
+	if elapsed > t.Max {
+		t.Max = elapsed
+		t.Slowest = tile
+	}
+	t.Count++
+	t.Total += elapsed
+}
+
+// StatsReport - снимок статистики рендера
+type StatsReport struct {
+	Elapsed time.Duration    // От начала первого тайла до конца последнего
+	Rays    [rayKinds]int64  // Лучей по RayKind
+	Tests   map[string]int64 // Проверок пересечения по типу объекта
+	Tiles   TileTimes
+}
+
+// Report возвращает снимок статистики
+func (s *RenderStats) Report() StatsReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	report := StatsReport{
+		Rays:  s.rays,
+		Tests: make(map[string]int64, len(s.tests)),
+		Tiles: s.tiles,
+	}
+	if !s.start.IsZero() {
+		report.Elapsed = s.end.Sub(s.start)
+	}
+	for kind, n := range s.tests {
+		report.Tests[kind] = n
+	}
+	return report
+}
+
+// TotalRays возвращает количество лучей всех видов
+func (r StatsReport) TotalRays() int64 {
+	var total int64
+	for _, n := range r.Rays {
+		total += n
+	}
+	return total
+}
+
+// String возвращает сводку для лога и окна, по строке на счётчик
+func (r StatsReport) String() string {
+	var b strings.Builder
+	total := r.TotalRays()
+	fmt.Fprintf(&b, "Rays: %d", total)
+	if r.Elapsed > 0 {
+		fmt.Fprintf(&b, " (%.2f M/s)", float64(total)/r.Elapsed.Seconds()/1e6)
+	}
+	for kind, n := range r.Rays {
+		fmt.Fprintf(&b, "\n  %-18s %d", RayKind(kind), n)
+	}
+
+	kinds := make([]string, 0, len(r.Tests))
+	var tests int64
+	for kind, n := range r.Tests {
+		kinds = append(kinds, kind)
+		tests += n
+	}
+	slices.Sort(kinds)
+	fmt.Fprintf(&b, "\nIntersection tests: %d", tests)
+	for _, kind := range kinds {
+		fmt.Fprintf(&b, "\n  %-18s %d", kind, r.Tests[kind])
+	}
+
+	t := r.Tiles
+	fmt.Fprintf(&b, "\nTiles: %d in %v, mean %v, min %v, max %v",
+		t.Count, r.Elapsed.Round(time.Millisecond), roundDuration(t.Mean()), roundDuration(t.Min), roundDuration(t.Max))
+	if t.Count > 0 {
+		fmt.Fprintf(&b, "\nSlowest tile: %d,%d-%d,%d", t.Slowest.Min.X, t.Slowest.Min.Y, t.Slowest.Max.X, t.Slowest.Max.Y)
+	}
+	return b.String()
+}
+
+// roundDuration округляет время тайла до точности, которую стоит печатать
+func roundDuration(d time.Duration) time.Duration {
+	if d >= time.Second {
+		return d.Round(time.Millisecond)
+	}
+	return d.Round(10 * time.Microsecond)
+}
+
+// objectKind возвращает название типа объекта для статистики
+func objectKind(obj SceneObject) string {
+	switch obj.(type) {
+	case *Sphere:
+		return "Sphere"
+	case *Cube:
+		return "Cube"
+	case *Torus:
+		return "Torus"
+	case *Tetrahedron:
+		return "Tetrahedron"
+	case *InfinityChessBoard:
+		return "InfinityChessBoard"
+	default:
+		return fmt.Sprintf("%T", obj)
+	}
+}
@@ -0,0 +1,60 @@
+package tracer
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+// Статистика считает по лучу из камеры на сэмпл, тест на каждый объект для каждого луча
+// и не меняет изображение
+func TestRenderStats(t *testing.T) {
+	const width, height, spp = 32, 16, 2
+
+	render := func(stats *RenderStats) []byte {
+		r := NewRenderer(testScene(width, height), width, height)
+		r.SamplesPerPixel = spp
+		r.Sampler = NewIndependentSampler(7)
+		r.Scheduler = Scheduler{TileSize: 8, Order: TileOrderScanline, Workers: 2}
+		r.Stats = stats
+		frame, err := r.Render(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return frame.Image.Pix
+	}
+
+	stats := NewRenderStats()
+	if !bytes.Equal(render(stats), render(nil)) {
+		t.Error("collecting stats changed the image")
+	}
+
+	report := stats.Report()
+	if got, want := report.Rays[RayPrimary], int64(width*height*spp); got != want {
+		t.Errorf("primary rays %d, want %d", got, want)
+	}
+	if report.Rays[RayShadow] == 0 || report.Rays[RayReflection] == 0 {
+		t.Errorf("no shadow or reflection rays: %v", report.Rays)
+	}
+	// Каждый луч проверяется со всеми тремя объектами сцены
+	for _, kind := range []string{"Sphere", "Cube", "InfinityChessBoard"} {
+		if got, want := report.Tests[kind], report.TotalRays(); got != want {
+			t.Errorf("%s tests %d, want %d", kind, got, want)
+		}
+	}
+	if got, want := report.Tiles.Count, len(SplitTiles(width, height, 8, TileOrderScanline)); got != want {
+		t.Errorf("%d tiles timed, want %d", got, want)
+	}
+	if report.Tiles.Min > report.Tiles.Max || report.Elapsed <= 0 {
+		t.Errorf("inconsistent timings: %+v, elapsed %v", report.Tiles, report.Elapsed)
+	}
+	if !strings.Contains(report.String(), "reflection") {
+		t.Errorf("summary lacks ray kinds:\n%s", report)
+	}
+
+	stats.Reset()
+	if report := stats.Report(); report.TotalRays() != 0 || report.Tiles.Count != 0 {
+		t.Errorf("Reset kept counters: %+v", report)
+	}
+}
@@ -1,4 +1,4 @@
-package main
+package tracer
 
 import "math"
 
@@ -68,9 +68,20 @@ func (t *Tetrahedron) Intersection(ray Ray) (IntersectionResult, bool) {
 	return closestIntersection, found
 }
 
+// intersectionSteps возвращает количество шагов поиска пересечения для режима DebugCost: по одному на грань
+func (t *Tetrahedron) intersectionSteps(ray Ray) int {
+	return len(t.Faces)
+}
+
 // pointInTriangle проверяет, находится ли точка внутри треугольника
 func pointInTriangle(p, v0, v1, v2 Vector) bool {
-	// Метод барицентрических координат
+	u, v, w := barycentric(p, v0, v1, v2)
+	return u >= 0 && v >= 0 && w >= 0
+}
+
+// barycentric возвращает барицентрические координаты проекции точки на плоскость треугольника.
+// Для вырожденного треугольника возвращает -1, чтобы точка считалась снаружи.
+func barycentric(p, v0, v1, v2 Vector) (float64, float64, float64) {
 	edge0 := v1.Sub(v0)
 	edge1 := v2.Sub(v0)
 	edge2 := p.Sub(v0)
@@ -83,18 +94,34 @@ func pointInTriangle(p, v0, v1, v2 Vector) bool {
 
 	denom := d00*d11 - d01*d01
 	if denom == 0 {
-		return false
+		return -1, -1, -1
 	}
 
 	v := (d11*d20 - d01*d21) / denom
 	w := (d00*d21 - d01*d20) / denom
 	u := 1.0 - v - w
-
-	return u >= 0 && v >= 0 && w >= 0
+	return u, v, w
 }
 
 func (t *Tetrahedron) GetNormal(hitPosition Vector) Vector {
 	// Находим ближайшую грань и возвращаем её нормаль
+	closestFace := t.closestFace(hitPosition)
+	if closestFace == -1 {
+		return Vector{0, 1, 0} // fallback
+	}
+
+	// Вычисляем нормаль для ближайшей грани
+	face := t.Faces[closestFace]
+	v0 := t.Vertices[face[0]]
+	v1 := t.Vertices[face[1]]
+	v2 := t.Vertices[face[2]]
+	edge1 := v1.Sub(v0)
+	edge2 := v2.Sub(v0)
+	return edge1.Cross(edge2).Normalize()
+}
+
+// closestFace возвращает номер грани, плоскость которой ближе всего к точке, или -1
+func (t *Tetrahedron) closestFace(hitPosition Vector) int {
 	closestFace := -1
 	minDist := math.MaxFloat64
 
@@ -113,19 +140,7 @@ func (t *Tetrahedron) GetNormal(hitPosition Vector) Vector {
 			closestFace = i
 		}
 	}
-
-	if closestFace == -1 {
-		return Vector{0, 1, 0} // fallback
-	}
-
-	// Вычисляем нормаль для ближайшей грани
-	face := t.Faces[closestFace]
-	v0 := t.Vertices[face[0]]
-	v1 := t.Vertices[face[1]]
-	v2 := t.Vertices[face[2]]
-	edge1 := v1.Sub(v0)
-	edge2 := v2.Sub(v0)
-	return edge1.Cross(edge2).Normalize()
+	return closestFace
 }
 
 func (t *Tetrahedron) GetMaterial(_ Vector) Material {
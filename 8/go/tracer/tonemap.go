@@ -0,0 +1,148 @@
+package tracer
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+)
+
+// ToneOperator - оператор тональной компрессии HDR яркости в диапазон дисплея
+type ToneOperator int
+
+const (
+	ToneClamp            ToneOperator = iota // Обрезка каналов до [0, 1]
+	ToneReinhard                             // L / (1 + L)
+	ToneReinhardExtended                     // Рейнхард с точкой белого
+	ToneHable                                // Кинематографическая кривая Hable (Uncharted 2)
+	ToneACES                                 // Аппроксимация ACES RRT+ODT (Stephen Hill)
+)
+
+var toneOperatorNames = map[ToneOperator]string{
+	ToneClamp:            "clamp",
+	ToneReinhard:         "reinhard",
+	ToneReinhardExtended: "reinhard-extended",
+	ToneHable:            "hable",
+	ToneACES:             "aces",
+}
+
+// ToneOperators - операторы в порядке переключения
+var ToneOperators = []ToneOperator{ToneClamp, ToneReinhard, ToneReinhardExtended, ToneHable, ToneACES}
+
+func (o ToneOperator) String() string {
+	if name, ok := toneOperatorNames[o]; ok {
+		return name
+	}
+	return fmt.Sprintf("ToneOperator(%d)", int(o))
+}
+
+// ParseToneOperator разбирает название оператора тональной компрессии
+func ParseToneOperator(name string) (ToneOperator, error) {
+	for _, o := range ToneOperators {
+		if o.String() == name {
+			return o, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown tone mapping operator %q (expected clamp, reinhard, reinhard-extended, hable or aces)", name)
+}
+
+// ToneMapper переводит линейную HDR яркость в 8-битный sRGB
+type ToneMapper struct {
+	Operator   ToneOperator
+	Exposure   float64 // Экспозиция в ступенях (EV), яркость умножается на 2^Exposure
+	WhitePoint float64 // Яркость, которая становится белой в расширенном Рейнхарде и Hable
+}
+
+// NewToneMapper создаёт тональный компрессор, повторяющий обрезку каналов
+func NewToneMapper() ToneMapper {
+	return ToneMapper{
+		Operator:   ToneClamp,
+		WhitePoint: 4,
+	}
+}
+
+// Map применяет экспозицию и оператор. Результат линейный, в диапазоне [0, 1].
+func (t ToneMapper) Map(c Vector) Vector {
+	c = c.Mul(math.Exp2(t.Exposure))
+	c = Vector{math.Max(0, c.X), math.Max(0, c.Y), math.Max(0, c.Z)}
+
+	switch t.Operator {
+	case ToneReinhard:
+		c = scaleLuminance(c, func(l float64) float64 { return l / (1 + l) })
+	case ToneReinhardExtended:
+		white2 := t.WhitePoint * t.WhitePoint
+		c = scaleLuminance(c, func(l float64) float64 { return l * (1 + l/white2) / (1 + l) })
+	case ToneHable:
+		white := hable(t.WhitePoint)
+		c = Vector{hable(c.X) / white, hable(c.Y) / white, hable(c.Z) / white}
+	case ToneACES:
+		c = acesFitted(c)
+	}
+
+	return Vector{saturate(c.X), saturate(c.Y), saturate(c.Z)}
+}
+
+// Encode переводит HDR цвет в пиксель sRGB
+func (t ToneMapper) Encode(c Vector) color.RGBA {
+	c = t.Map(c)
+	return color.RGBA{
+		R: uint8(math.Round(linearToSRGB(c.X) * 255)),
+		G: uint8(math.Round(linearToSRGB(c.Y) * 255)),
+		B: uint8(math.Round(linearToSRGB(c.Z) * 255)),
+		A: 255,
+	}
+}
+
+// scaleLuminance сжимает яркость цвета кривой curve, сохраняя оттенок
+func scaleLuminance(c Vector, curve func(float64) float64) Vector {
+	l := c.Luminance()
+	if l <= 0 {
+		return c
+	}
+	return c.Mul(curve(l) / l)
+}
+
+// hable - кривая John Hable для Uncharted 2
+func hable(x float64) float64 {
+	const a, b, c, d, e, f = 0.15, 0.50, 0.10, 0.20, 0.02, 0.30
+	return (x*(a*x+c*b)+d*e)/(x*(a*x+b)+d*f) - e/f
+}
+
+// acesFitted - аппроксимация ACES Стивена Хилла: перевод в пространство RRT, кривая и обратно в sRGB
+func acesFitted(c Vector) Vector {
+	c = Vector{
+		0.59719*c.X + 0.35458*c.Y + 0.04823*c.Z,
+		0.07600*c.X + 0.90834*c.Y + 0.01566*c.Z,
+		0.02840*c.X + 0.13383*c.Y + 0.83777*c.Z,
+	}
+
+	fit := func(v float64) float64 {
+		return (v*(v+0.0245786) - 0.000090537) / (v*(0.983729*v+0.4329510) + 0.238081)
+	}
+	c = Vector{fit(c.X), fit(c.Y), fit(c.Z)}
+
+	return Vector{
+		1.60475*c.X - 0.53108*c.Y - 0.07367*c.Z,
+		-0.10208*c.X + 1.10813*c.Y - 0.00605*c.Z,
+		-0.00327*c.X - 0.07276*c.Y + 1.07602*c.Z,
+	}
+}
+
+// linearToSRGB - передаточная функция sRGB для значения из [0, 1]
+func linearToSRGB(v float64) float64 {
+	if v <= 0.0031308 {
+		return 12.92 * v
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// srgbToLinear - обратная передаточная функция sRGB
+func srgbToLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func saturate(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
@@ -1,4 +1,4 @@
-package main
+package tracer
 
 import "math"
 
@@ -25,6 +25,18 @@ func (t *Torus) distanceFunction(p Vector) float64 {
 
 // Упрощённый поиск пересечения луча с тором (метод секущих)
 func (t *Torus) Intersection(ray Ray) (IntersectionResult, bool) {
+	intersection, _, hit := t.march(ray)
+	return intersection, hit
+}
+
+// intersectionSteps возвращает количество шагов поиска пересечения для режима DebugCost
+func (t *Torus) intersectionSteps(ray Ray) int {
+	_, steps, _ := t.march(ray)
+	return steps
+}
+
+// march шагает вдоль луча до поверхности и возвращает пересечение и число сделанных шагов
+func (t *Torus) march(ray Ray) (IntersectionResult, int, bool) {
 	const maxSteps = 10000
 	const epsilon = 1e-2
 
@@ -43,14 +55,14 @@ func (t *Torus) Intersection(ray Ray) (IntersectionResult, bool) {
 				Point:    point,
 				Distance: tCurrent,
 				Object:   t,
-			}, true
+			}, i + 1, true
 		}
 
 		// Корректируем шаг
 		tCurrent += step * 0.5 // Уменьшаем шаг для точности
 	}
 
-	return IntersectionResult{}, false
+	return IntersectionResult{}, maxSteps, false
 }
 
 // Нормаль к поверхности тора (чецентральные разности)
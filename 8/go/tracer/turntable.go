@@ -0,0 +1,111 @@
+package tracer
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// TurntableOptions описывает облёт камеры вокруг точки
+type TurntableOptions struct {
+	Target      Vector  // Точка, вокруг которой вращается камера
+	Radius      float64 // Радиус орбиты
+	Elevation   float64 // Угол возвышения камеры в градусах
+	Revolutions float64 // Количество оборотов за всю анимацию
+	Frames      int     // Количество кадров
+	Output      string  // GIF файл или каталог для PNG кадров
+	Delay       int     // Задержка между кадрами GIF в сотых долях секунды
+
+	Process func(frame *Frame) *Frame // Обработка кадра перед сохранением, nil - без обработки
+}
+
+// RenderTurntable рендерит кадры облёта и сохраняет их как GIF или последовательность PNG.
+// Объекты сцены общие для всех кадров, между кадрами меняется только камера.
+func (r *Renderer) RenderTurntable(ctx context.Context, opts TurntableOptions) error {
+	if opts.Frames <= 0 {
+		return fmt.Errorf("turntable needs at least one frame, got %d", opts.Frames)
+	}
+
+	asGIF := strings.HasSuffix(strings.ToLower(opts.Output), ".gif")
+	if !asGIF {
+		if err := os.MkdirAll(opts.Output, 0755); err != nil {
+			return fmt.Errorf("failed to create frames directory: %w", err)
+		}
+	}
+
+	base := r.Scene.Camera
+	frameRenderer := *r
+
+	anim := &gif.GIF{}
+	for i := 0; i < opts.Frames; i++ {
+		azimuth := 360 * opts.Revolutions * float64(i) / float64(opts.Frames)
+		frameRenderer.Scene = r.Scene.WithCamera(base.Orbit(opts.Target, opts.Radius, azimuth, opts.Elevation))
+
+		start := time.Now()
+		frame, err := frameRenderer.Render(ctx)
+		if err != nil {
+			return err
+		}
+		log.Printf("Кадр %d/%d готов за %v", i+1, opts.Frames, time.Since(start).Round(time.Millisecond))
+
+		if opts.Process != nil {
+			frame = opts.Process(frame)
+		}
+
+		if asGIF {
+			paletted := image.NewPaletted(frame.Image.Bounds(), palette.Plan9)
+			draw.FloydSteinberg.Draw(paletted, frame.Image.Bounds(), frame.Image, image.Point{})
+			anim.Image = append(anim.Image, paletted)
+			anim.Delay = append(anim.Delay, opts.Delay)
+			continue
+		}
+
+		name := filepath.Join(opts.Output, fmt.Sprintf("frame_%04d.png", i))
+		if err := SavePNG(name, frame.Image); err != nil {
+			return err
+		}
+	}
+
+	if !asGIF {
+		return nil
+	}
+
+	if dir := filepath.Dir(opts.Output); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create output directory: %w", err)
+		}
+	}
+	file, err := os.Create(opts.Output)
+	if err != nil {
+		return fmt.Errorf("failed to create gif: %w", err)
+	}
+	defer file.Close()
+
+	if err := gif.EncodeAll(file, anim); err != nil {
+		return fmt.Errorf("failed to encode gif: %w", err)
+	}
+	return nil
+}
+
+// SavePNG сохраняет изображение в PNG файл
+func SavePNG(filename string, img image.Image) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", filename, err)
+	}
+	defer file.Close()
+
+	if err := png.Encode(file, img); err != nil {
+		return fmt.Errorf("failed to encode %s: %w", filename, err)
+	}
+	return nil
+}
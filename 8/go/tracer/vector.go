@@ -1,4 +1,4 @@
-package main
+package tracer
 
 import (
 	"fmt"
@@ -143,6 +143,11 @@ func (v Vector) ToRGB() (float64, float64, float64) {
 	return r * 255, g * 255, b * 255
 }
 
+// Luminance возвращает относительную яркость цвета (коэффициенты Rec. 709)
+func (v Vector) Luminance() float64 {
+	return 0.2126*v.X + 0.7152*v.Y + 0.0722*v.Z
+}
+
 // Comparison methods
 func (v Vector) GreaterThan(other interface{}) bool {
 	switch o := other.(type) {
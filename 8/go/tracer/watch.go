@@ -0,0 +1,59 @@
+package tracer
+
+import (
+	"os"
+	"time"
+)
+
+// FileWatcher замечает изменения файлов, опрашивая время изменения и размер.
+// Отсутствующий файл тоже имеет состояние: его появление считается изменением.
+type FileWatcher struct {
+	files map[string]fileState
+}
+
+type fileState struct {
+	exists  bool
+	modTime time.Time
+	size    int64
+}
+
+func statFile(path string) fileState {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileState{}
+	}
+	return fileState{exists: true, modTime: info.ModTime(), size: info.Size()}
+}
+
+// NewFileWatcher начинает следить за файлами paths с их текущего состояния
+func NewFileWatcher(paths ...string) *FileWatcher {
+	w := &FileWatcher{}
+	w.Watch(paths...)
+	return w
+}
+
+// Watch заменяет список файлов. Уже известные файлы сохраняют запомненное состояние,
+// чтобы изменение между опросами не потерялось, новые запоминаются как есть.
+func (w *FileWatcher) Watch(paths ...string) {
+	files := make(map[string]fileState, len(paths))
+	for _, path := range paths {
+		if state, ok := w.files[path]; ok {
+			files[path] = state
+		} else {
+			files[path] = statFile(path)
+		}
+	}
+	w.files = files
+}
+
+// Changed опрашивает файлы и сообщает, изменился ли хоть один с прошлого опроса
+func (w *FileWatcher) Changed() bool {
+	changed := false
+	for path, state := range w.files {
+		if current := statFile(path); current != state {
+			w.files[path] = current
+			changed = true
+		}
+	}
+	return changed
+}